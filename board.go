@@ -1 +1,184 @@
 package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// SAN returns the move in standard algebraic notation, given the board
+// before the move was made. Check and mate markers are not added.
+func SAN(b *pgn.Board, move pgn.Move) string {
+	piece := b.GetPiece(move.From)
+	capture := b.GetPiece(move.To) != pgn.NoPiece
+	to := move.To.String()
+
+	switch piece {
+	case pgn.WhiteKing, pgn.BlackKing:
+		if move.From.GetFile() == pgn.FileE && move.To.GetFile() == pgn.FileG {
+			return "O-O"
+		}
+		if move.From.GetFile() == pgn.FileE && move.To.GetFile() == pgn.FileC {
+			return "O-O-O"
+		}
+	case pgn.WhitePawn, pgn.BlackPawn:
+		san := to
+		if move.From.GetFile() != move.To.GetFile() {
+			san = string(move.From.GetFile()) + "x" + to
+		}
+		if move.Promote != pgn.NoPiece {
+			san += "=" + strings.ToUpper(string(move.Promote))
+		}
+		return san
+	case pgn.NoPiece:
+		return Coord(move)
+	}
+
+	letter := strings.ToUpper(string(piece))
+	disambiguation := move.From.String()
+	for _, candidate := range []string{"", string(move.From.GetFile()), string(move.From.GetRank())} {
+		found, err := b.MoveFromAlgebraic(letter+candidate+to, piece.Color())
+		if err == nil && found.From == move.From {
+			disambiguation = candidate
+			break
+		}
+	}
+	if capture {
+		return letter + disambiguation + "x" + to
+	}
+	return letter + disambiguation + to
+}
+
+// possibleMove checks what MoveFromAlgebraic doesn't: that the move
+// doesn't capture one of the player's own pieces, and that a pawn moves
+// forward over empty squares only, one square or two from its starting
+// rank.
+func possibleMove(b *pgn.Board, move pgn.Move, color pgn.Color) bool {
+	if target := b.GetPiece(move.To); target != pgn.NoPiece && target.Color() == color {
+		return false
+	}
+	piece := b.GetPiece(move.From)
+	if piece != pgn.WhitePawn && piece != pgn.BlackPawn || move.From.GetFile() != move.To.GetFile() {
+		return true
+	}
+	forward, start := pgn.Rank(1), pgn.Rank2
+	if color == pgn.Black {
+		forward, start = pgn.Rank(0xff), pgn.Rank7
+	}
+	next := move.From.GetRank() + forward
+	if b.GetPiece(move.To) != pgn.NoPiece {
+		return false
+	}
+	if move.To.GetRank() == next {
+		return true
+	}
+	return move.From.GetRank() == start && move.To.GetRank() == next+forward &&
+		b.GetPiece(pgn.PositionFromFileRank(move.From.GetFile(), next)) == pgn.NoPiece
+}
+
+// Coord returns the move in coordinate notation, e.g. e2e4 or e7e8q, as
+// MoveFromCoord parses it. pgn.Move's String writes the promotion piece as
+// a number.
+func Coord(move pgn.Move) string {
+	coord := move.From.String() + move.To.String()
+	if move.Promote != pgn.NoPiece && move.Promote != 0 {
+		coord += strings.ToLower(string(move.Promote))
+	}
+	return coord
+}
+
+// PositionKey identifies the position on the board by its piece placement,
+// side to move and castling rights. The move counters and en passant square
+// are left out, so that transpositions and FEN tags from different sites
+// compare equal.
+func PositionKey(b *pgn.Board) string {
+	fields := strings.Fields(b.String())
+	return strings.Join(fields[:3], " ")
+}
+
+// FormatLine formats a list of moves in coordinate notation (e.g. e2e4), as
+// they are stored in the MoveTree, as numbered SAN moves: 1.e4 c5 2.Nf3
+func FormatLine(moves []string) string {
+	return FormatMoves(pgn.NewBoard(), moves)
+}
+
+// ParseLine parses a sequence of moves from the starting position, in SAN
+// or coordinate notation, e.g. "1. e4 c5 2. Nf3". It returns the moves in
+// coordinate notation and the board after them.
+func ParseLine(line string) ([]string, *pgn.Board, error) {
+	b := pgn.NewBoard()
+	played := []string{}
+	for _, token := range TokenizeMovetext(line) {
+		if token == "(" || token == ")" || strings.HasPrefix(token, "{") {
+			return nil, nil, fmt.Errorf("Invalid moves '%s': comments and variations are not supported", line)
+		}
+		white := len(played)%2 == 0
+		coord := ParseMove(b, strings.TrimRight(token, "+#!?"), white)
+		if coord == "" {
+			return nil, nil, fmt.Errorf("Invalid move '%s' after '%s'", token, FormatLine(played))
+		}
+		move, _ := pgn.MoveFromCoord(coord)
+		b.MakeMove(move)
+		played = append(played, coord)
+	}
+	return played, b, nil
+}
+
+// FormatMoves formats moves in coordinate notation played from the given
+// position, numbered from its move number: 12...Nf6 13.Bg5
+func FormatMoves(position *pgn.Board, moves []string) string {
+	board := *position
+	b := &board
+	fields := strings.Fields(b.String())
+	whiteToMove := len(fields) < 2 || fields[1] == "w"
+	number := 1
+	if len(fields) > 5 {
+		if n, err := strconv.Atoi(fields[5]); err == nil {
+			number = n
+		}
+	}
+	result := []string{}
+	for i, coord := range moves {
+		move, err := pgn.MoveFromCoord(coord)
+		if err != nil {
+			result = append(result, coord)
+			continue
+		}
+		san := SAN(b, move)
+		if whiteToMove {
+			san = fmt.Sprintf("%d.%s", number, san)
+		} else if i == 0 {
+			san = fmt.Sprintf("%d...%s", number, san)
+		}
+		if !whiteToMove {
+			number++
+		}
+		whiteToMove = !whiteToMove
+		result = append(result, san)
+		b.MakeMove(move)
+	}
+	return strings.Join(result, " ")
+}
+
+// GameBoard returns the position after the first plies moves of the game,
+// starting from its FEN tag if it has one. It returns false if the game is
+// shorter than that.
+func GameBoard(game *pgn.Game, plies int) (*pgn.Board, bool) {
+	b := pgn.NewBoard()
+	if fen := game.Tags["FEN"]; fen != "" {
+		var err error
+		b, err = pgn.NewBoardFEN(fen)
+		if err != nil {
+			return nil, false
+		}
+	}
+	if len(game.Moves) < plies {
+		return nil, false
+	}
+	for _, move := range game.Moves[:plies] {
+		b.MakeMove(move)
+	}
+	return b, true
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/freeeve/pgn"
+	"github.com/olekukonko/tablewriter"
+)
+
+// BookExitStatistic keeps track of where the games in an opening left the
+// opening tree.
+type BookExitStatistic struct {
+	Games      int
+	InBook     int
+	BookPlies  int
+	ByPlayer   int
+	ByOpponent int
+
+	// The player's own non-book moves, keyed by position and move.
+	Deviations map[string]*BookDeviation
+}
+
+// BookDeviation is a non-book move that was played in a book position.
+type BookDeviation struct {
+	Node  *MoveTree
+	Move  string
+	Count int
+}
+
+func NewBookExitStatistic() *BookExitStatistic {
+	return &BookExitStatistic{
+		Deviations: map[string]*BookDeviation{},
+	}
+}
+
+func (s *BookExitStatistic) Count(white bool, classification *Classification) {
+	s.Games += 1
+	if !classification.LeftBook() {
+		s.InBook += 1
+		return
+	}
+	s.BookPlies += classification.BookPlies
+	if classification.DeviatedByWhite() != white {
+		s.ByOpponent += 1
+		return
+	}
+	s.ByPlayer += 1
+	key := strings.Join(append(classification.Node.Line(), classification.Deviation), " ")
+	if _, ok := s.Deviations[key]; !ok {
+		s.Deviations[key] = &BookDeviation{
+			Node: classification.Node,
+			Move: classification.Deviation,
+		}
+	}
+	s.Deviations[key].Count += 1
+}
+
+// AverageExitPly returns the average ply at which the games that left book
+// played their first non-book move.
+func (s *BookExitStatistic) AverageExitPly() float64 {
+	left := s.Games - s.InBook
+	if left == 0 {
+		return 0
+	}
+	return float64(s.BookPlies)/float64(left) + 1
+}
+
+func (s *BookExitStatistic) Data() []string {
+	averagePly := ""
+	if s.Games > s.InBook {
+		averagePly = fmt.Sprintf("%.1f", s.AverageExitPly())
+	}
+	return []string{
+		fmt.Sprintf("%d", s.Games),
+		averagePly,
+		percentage(s.ByPlayer, s.Games),
+		percentage(s.ByOpponent, s.Games),
+		percentage(s.InBook, s.Games),
+	}
+}
+
+// SortedDeviations returns the player's deviations, most frequent first.
+func (s *BookExitStatistic) SortedDeviations() []*BookDeviation {
+	result := []*BookDeviation{}
+	for _, deviation := range s.Deviations {
+		result = append(result, deviation)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return FormatLine(result[i].Node.Line()) < FormatLine(result[j].Node.Line())
+	})
+	return result
+}
+
+// Played returns the deviating move in SAN.
+func (d *BookDeviation) Played() string {
+	move, err := pgn.MoveFromCoord(d.Move)
+	if err != nil {
+		return d.Move
+	}
+	return SAN(d.Node.Board(), move)
+}
+
+// Book returns the most common book continuations in SAN.
+func (d *BookDeviation) Book(n int) []string {
+	b := d.Node.Board()
+	result := []string{}
+	for _, tree := range d.Node.BookContinuations() {
+		if len(result) == n {
+			break
+		}
+		move, err := pgn.MoveFromCoord(tree.Move)
+		if err != nil {
+			continue
+		}
+		result = append(result, SAN(b, move))
+	}
+	return result
+}
+
+func (r *Report) BookExitReport() string {
+	openings := []string{}
+	for opening := range r.BookExits {
+		openings = append(openings, opening)
+	}
+	sort.Strings(openings)
+
+	b := bytes.NewBuffer([]byte{})
+	table := tablewriter.NewWriter(b)
+	table.SetHeader([]string{"Opening", "Games", "Exit ply", "Left by " + r.Player, "Left by opponent", "Stayed in book"})
+	for _, opening := range openings {
+		table.Append(append([]string{opening}, r.BookExits[opening].Data()...))
+	}
+	table.SetRowLine(true)
+	table.Render()
+
+	deviations := tablewriter.NewWriter(b)
+	deviations.SetHeader([]string{"Opening", "Line", "Played", "Book", "Games"})
+	for _, opening := range openings {
+		for _, deviation := range r.BookExits[opening].SortedDeviations() {
+			deviations.Append([]string{
+				opening,
+				FormatLine(deviation.Node.Line()),
+				deviation.Played(),
+				strings.Join(deviation.Book(3), ", "),
+				fmt.Sprintf("%d", deviation.Count),
+			})
+		}
+	}
+	deviations.SetRowLine(true)
+	deviations.Render()
+	return string(b.Bytes())
+}
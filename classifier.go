@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// Classifier places games in an opening classification. The scid .eco and
+// lichess TSV formats define their openings by moves and are read into a
+// MoveTree; EPD files define them by position, see EPDClassifier.
+type Classifier interface {
+	// Classify follows the game through the classification and records
+	// where it left book.
+	Classify(game *pgn.Game) *Classification
+	// Tree returns the named positions of the classification as a tree,
+	// from which the player's move trees copy their annotations.
+	Tree() *MoveTree
+}
+
+func (m *MoveTree) Tree() *MoveTree {
+	return m
+}
+
+// ClassificationFormats are the supported formats of ReadClassifier.
+var ClassificationFormats = map[string]string{
+	".eco": "scid",
+	".tsv": "lichess",
+	".epd": "epd",
+}
+
+// ReadClassifier reads the classification in the given files, which all
+// need to have the same format: scid, lichess or epd. If the format is
+// empty it's derived from the extension of the first file. It also returns
+// a hash of the format and the files, which changes when the
+// classification does.
+func ReadClassifier(paths []string, format string) (Classifier, string, error) {
+	if format == "" {
+		format = ClassificationFormats[strings.ToLower(filepath.Ext(paths[0]))]
+	}
+	tree := NewMoveTree("", "Start position")
+	epd := NewEPDClassifier()
+	hash := sha1.New()
+	fmt.Fprintf(hash, "%s\n", format)
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, "", err
+		}
+		hash.Write(content)
+		switch format {
+		case "scid":
+			err = tree.AddScidECO(string(content))
+		case "lichess":
+			err = tree.AddLichessTSV(string(content))
+		case "epd":
+			err = epd.AddEPD(string(content))
+		default:
+			return nil, "", fmt.Errorf("Unknown classification format '%s' for '%s'. One of: scid, lichess, epd", format, path)
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("Invalid classification '%s': %s", path, err.Error())
+		}
+	}
+	sum := fmt.Sprintf("%x", hash.Sum(nil))
+	if format == "epd" {
+		return epd, sum, nil
+	}
+	return tree, sum, nil
+}
+
+// AddLichessTSV adds the openings in the format of the lichess
+// chess-openings repository to the tree: tab separated columns with the ECO
+// code, the name and the moves, after a header line.
+func (m *MoveTree) AddLichessTSV(content string) error {
+	for i, line := range strings.Split(content, "\n") {
+		if strings.TrimSpace(line) == "" || i == 0 && strings.HasPrefix(line, "eco\t") {
+			continue
+		}
+		columns := strings.Split(line, "\t")
+		if len(columns) < 3 {
+			return fmt.Errorf("Invalid opening on line %d: %s", i+1, line)
+		}
+		if err := m.AddNodeForPGN(columns[0], columns[1], columns[2]); err != nil {
+			return fmt.Errorf("Invalid opening on line %d: %s", i+1, err.Error())
+		}
+	}
+	return nil
+}
+
+// EPDOpening is an opening defined by a position in an EPD file.
+type EPDOpening struct {
+	ECO  string
+	Name string
+}
+
+// EPDClassifier classifies games by the last position with an ECO or
+// opening opcode that they reach, so also by transposition. As the
+// positions don't say how they were reached, the tree is built from the
+// games that are counted: every game adds its moves up to its last named
+// position.
+type EPDClassifier struct {
+	Openings map[string]*EPDOpening
+	tree     *MoveTree
+}
+
+func NewEPDClassifier() *EPDClassifier {
+	return &EPDClassifier{
+		Openings: map[string]*EPDOpening{},
+		tree:     NewMoveTree("", "Start position"),
+	}
+}
+
+// AddEPD adds the positions in an EPD file, e.g.
+//
+//	rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - ECO "B00"; opening "King's Pawn";
+//
+// A variation opcode is added to the opening's name. Positions without ECO
+// or opening opcodes are skipped.
+func (e *EPDClassifier) AddEPD(content string) error {
+	for i, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 5)
+		if len(fields) < 4 {
+			return fmt.Errorf("Invalid position on line %d: %s", i+1, line)
+		}
+		b, err := pgn.NewBoardFEN(strings.Join(fields[:4], " ") + " 0 1")
+		if err != nil {
+			return fmt.Errorf("Invalid position on line %d: %s", i+1, line)
+		}
+		opcodes := map[string]string{}
+		if len(fields) == 5 {
+			for _, operation := range strings.Split(fields[4], ";") {
+				parts := strings.SplitN(strings.TrimSpace(operation), " ", 2)
+				if len(parts) == 2 {
+					opcodes[strings.ToLower(parts[0])] = strings.Trim(strings.TrimSpace(parts[1]), `"`)
+				}
+			}
+		}
+		opening := &EPDOpening{ECO: opcodes["eco"], Name: opcodes["opening"]}
+		if variation := opcodes["variation"]; variation != "" {
+			opening.Name += ": " + variation
+		}
+		if opening.Name == "" {
+			opening.Name = opening.ECO
+		}
+		if opening.Name != "" {
+			e.Openings[PositionKey(b)] = opening
+		}
+	}
+	return nil
+}
+
+// Classify follows the game through its own moves up to the last named
+// position it reaches, so that the result doesn't depend on the games that
+// were classified before. The tree is only changed when the game is
+// counted, see Classification.CountGame. Games that start from a custom
+// position are looked up in the positions of the games counted so far.
+func (e *EPDClassifier) Classify(game *pgn.Game) *Classification {
+	if IsCustomStart(game) {
+		return e.tree.Classify(game)
+	}
+	classification := e.line(game).Classify(game)
+	classification.tree = e.tree
+	return classification
+}
+
+func (e *EPDClassifier) Tree() *MoveTree {
+	return e.tree
+}
+
+// line returns the moves of the game up to its last named position as a
+// tree of its own.
+func (e *EPDClassifier) line(game *pgn.Game) *MoveTree {
+	b := pgn.NewBoard()
+	last := 0
+	for i, move := range game.Moves {
+		b.MakeMove(move)
+		if _, ok := e.Openings[PositionKey(b)]; ok {
+			last = i + 1
+		}
+	}
+	root := NewMoveTree("", "Start position")
+	b = pgn.NewBoard()
+	tree := root
+	for _, move := range game.Moves[:last] {
+		b.MakeMove(move)
+		tree = tree.GetOrInsertMove(Coord(move))
+		tree.Book = true
+		if opening, ok := e.Openings[PositionKey(b)]; ok {
+			tree.Annotation = opening.Name
+			tree.ECO = opening.ECO
+		}
+	}
+	return root
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestAddLichessTSV(t *testing.T) {
+	for _, test := range []struct {
+		tsv string
+		err string
+	}{
+		{"eco\tname\tpgn\nC20\tKing's Pawn Game\t1. e4 e5\n", ""},
+		{"eco\tname\tpgn\nC20\tKing's Pawn Game\t1. e4 e5\nB00\tBroken\t1. e4 e4\n", "Invalid opening on line 3: Invalid move 'e4' after '1.e4'"},
+		{"eco\tname\tpgn\nA00\tBroken\t1. e2e5\n", "Invalid opening on line 2: Invalid move 'e2e5' after ''"},
+		{"eco\tname\tpgn\nA00\tBroken\t1. e4 {\n", "Invalid opening on line 2: Invalid moves '1. e4 {': comments and variations are not supported"},
+		{"eco\tname\tpgn\nA00\tBroken\n", "Invalid opening on line 2: A00\tBroken"},
+	} {
+		tree := NewMoveTree("", "Start position")
+		err := tree.AddLichessTSV(test.tsv)
+		if test.err == "" && err != nil {
+			t.Errorf("Unexpected error %s", err)
+		} else if test.err != "" && (err == nil || err.Error() != test.err) {
+			t.Errorf("Expected error %q, got %v", test.err, err)
+		}
+	}
+}
+
+func TestEPDClassifierClassify(t *testing.T) {
+	classifier := NewEPDClassifier()
+	err := classifier.AddEPD(`rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - ECO "B00"; opening "King's Pawn";
+rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - ECO "C40"; opening "King's Knight";
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	games, err := ParsePGN("1. e4 e5 2. Nf3 Nc6 *\n\n1. e4 e5 2. Bc4 *\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	knight, bishop := games[0].Game, games[1].Game
+	before := classifier.Classify(bishop)
+	classification := classifier.Classify(knight)
+	if len(classifier.Tree().Replies) != 0 {
+		t.Fatalf("Expected classifying to leave the tree alone")
+	}
+	if classification.Opening != "King's Knight" || classification.BookPlies != 3 || classification.Deviation != "b8c6" {
+		t.Errorf("Expected King's Knight after 3 plies, got %s after %d", classification.Opening, classification.BookPlies)
+	}
+	classification.CountGame(knight)
+	node := classifier.Tree().Follow([]string{"e2e4", "e7e5", "g1f3"})
+	if node == nil || node != classification.Node || node.Annotation != "King's Knight" || len(node.Games) != 1 {
+		t.Fatalf("Expected counting to add the line to the tree")
+	}
+	// the bishop's game doesn't follow the knight's line further than its
+	// own last named position
+	after := classifier.Classify(bishop)
+	if before.Opening != "King's Pawn" || after.Opening != before.Opening ||
+		after.BookPlies != 1 || before.BookPlies != 1 || after.Deviation != "e7e5" {
+		t.Errorf("Expected King's Pawn after 1 ply, got %s after %d and %s after %d",
+			before.Opening, before.BookPlies, after.Opening, after.BookPlies)
+	}
+}
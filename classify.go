@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/freeeve/pgn"
+	"github.com/olekukonko/tablewriter"
+)
+
+// ClassifyOpening returns the name under which the game is reported, using
+// one of the classification strategies:
+//
+//	tree      the scid.eco move tree
+//	tag       the ECO, ECOUrl and Opening tags set by chess.com and lichess
+//	tree-tag  the move tree, falling back to the tags for games that
+//	          didn't reach a named book position
+//
+// The empty string is returned when the opening is unknown.
+func ClassifyOpening(strategy, groupBy string, classification *Classification, game *pgn.Game) string {
+	switch strategy {
+	case "tag":
+		return TagOpening(game, groupBy)
+	case "tree-tag":
+		if classification.Found() {
+			return classification.Group(groupBy)
+		}
+		return TagOpening(game, groupBy)
+	}
+	if classification.Found() {
+		return classification.Group(groupBy)
+	}
+	return ""
+}
+
+// GameClassification returns the classification stored with the game, or
+// else classifies it.
+func GameClassification(classifier Classifier, game *Game) *Classification {
+	if game.Classification != nil {
+		return game.Classification
+	}
+	return classifier.Classify(game.Game)
+}
+
+// ReportOpening returns the name the game is reported under: the
+// ClassifyOpening for the --classify strategy and --group-by granularity,
+// "Non-standard start" for games from a position that isn't in the tree, or
+// "Unknown opening".
+func ReportOpening(classification *Classification, game *pgn.Game) string {
+	if classification.CustomStart && classification.Start == nil {
+		return "Non-standard start"
+	}
+	if opening := ClassifyOpening(*Classify, *GroupBy, classification, game); opening != "" {
+		return opening
+	}
+	return "Unknown opening"
+}
+
+// TagOpening returns the opening according to the game's tags. The tags
+// don't use extended codes, so the extended and variation granularities are
+// reported per ECO code.
+func TagOpening(game *pgn.Game, groupBy string) string {
+	eco := game.Tags["ECO"]
+	if groupBy == "name" {
+		if name := TagOpeningName(game); name != "" {
+			return name
+		}
+		if eco == "" || eco == "?" {
+			return ""
+		}
+		return LookupECO(eco)
+	}
+	if eco == "" || eco == "?" {
+		return ""
+	}
+	prefix := ECOPrefix(eco, groupBy)
+	if groupBy == "family" {
+		return prefix + " " + ECOFamilies[prefix]
+	}
+	return LookupECO(prefix)
+}
+
+// TagOpeningName returns the name in lichess' Opening tag, or the name in
+// the last part of chess.com's ECOUrl tag.
+func TagOpeningName(game *pgn.Game) string {
+	if name := game.Tags["Opening"]; name != "" && name != "?" {
+		return name
+	}
+	ecoURL := game.Tags["ECOUrl"]
+	if ecoURL == "" {
+		return ""
+	}
+	u, err := url.Parse(ecoURL)
+	if err != nil {
+		return ""
+	}
+	return strings.Replace(path.Base(u.Path), "-", " ", -1)
+}
+
+// ClassificationMismatch is a game where the scid.eco classification
+// disagrees with the ECO, Opening or ECOUrl tags.
+type ClassificationMismatch struct {
+	Game           *pgn.Game
+	Classification *Classification
+}
+
+// IsClassificationMismatch returns whether the tree classification differs
+// from the game's tags. The sites' codes and names are often shallower than
+// scid's, so the tags match if they match any of the named positions on the
+// game's book line: the basic ECO code of one of them is the ECO tag, and
+// the opening family of one of them is part of the name in the Opening or
+// ECOUrl tag. Games that weren't classified by either are not considered
+// mismatches.
+func IsClassificationMismatch(classification *Classification, game *pgn.Game) bool {
+	if !classification.Found() {
+		return false
+	}
+	if eco := game.Tags["ECO"]; len(eco) >= 3 && !pathMatches(classification, func(node *MoveTree) bool {
+		return node.ECO != "" && ECOPrefix(node.ECO, "eco") == ECOPrefix(eco, "eco")
+	}) {
+		return true
+	}
+	name := TagOpeningName(game)
+	return name != "" && !pathMatches(classification, func(node *MoveTree) bool {
+		return node.ECO != "" && OpeningNameMatches(node.Annotation, name)
+	})
+}
+
+// pathMatches returns whether one of the positions from the last book
+// position back to the start matches.
+func pathMatches(classification *Classification, match func(node *MoveTree) bool) bool {
+	for node := classification.Node; node != nil; node = node.Parent {
+		if match(node) {
+			return true
+		}
+	}
+	return false
+}
+
+// openingFamilyAliases are the names the sites use for scid's opening
+// families, where they differ.
+var openingFamilyAliases = map[string][]string{
+	"Spanish":       {"Ruy Lopez"},
+	"QGD":           {"Queen's Gambit Declined"},
+	"QGD Tarrasch":  {"Queen's Gambit Declined", "Tarrasch"},
+	"QGA":           {"Queen's Gambit Accepted"},
+	"KGA":           {"King's Gambit Accepted"},
+	"KGD":           {"King's Gambit Declined"},
+	"Gruenfeld":     {"Grünfeld", "Grunfeld"},
+	"Neo-Gruenfeld": {"Neo-Grünfeld", "Neo-Grunfeld"},
+	"Reti":          {"Réti"},
+	"Russian Game":  {"Petrov", "Petrovs", "Petroff"},
+	"Centre Game":   {"Center Game"},
+	"Open Game":     {"King's Pawn", "King's Knight"},
+}
+
+// ignoredOpeningWords are left out when comparing opening names, as the
+// naming schemes don't use them consistently.
+var ignoredOpeningWords = map[string]bool{
+	"defense":   true,
+	"defence":   true,
+	"opening":   true,
+	"game":      true,
+	"variation": true,
+	"the":       true,
+}
+
+// openingWords returns the lower case words in an opening name, without
+// punctuation and the ignoredOpeningWords.
+func openingWords(name string) []string {
+	words := []string{}
+	for _, word := range strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == ' ' || r == '-' || r == ':' || r == ',' || r == '.'
+	}) {
+		word = strings.Map(func(r rune) rune {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				return r
+			}
+			return -1
+		}, word)
+		if word != "" && !ignoredOpeningWords[word] {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// OpeningNameMatches returns whether the family of the scid opening, the
+// part of the name before the first colon or comma, or one of its
+// openingFamilyAliases is part of the opening name in the tags, e.g.
+// "Sicilian: Najdorf" and "Sicilian Defense Najdorf Variation", or
+// "Spanish: Closed" and "Ruy Lopez Opening Morphy Defense".
+func OpeningNameMatches(scidName, tagName string) bool {
+	family := scidName
+	if i := strings.IndexAny(family, ":,"); i >= 0 {
+		family = family[:i]
+	}
+	tagWords := map[string]bool{}
+	for _, word := range openingWords(tagName) {
+		tagWords[word] = true
+	}
+	for _, name := range append([]string{family}, familyAliases(family)...) {
+		if containsWords(tagWords, openingWords(name)) {
+			return true
+		}
+	}
+	return false
+}
+
+// familyAliases returns the openingFamilyAliases of the family, ignoring
+// the words that openingWords leaves out, e.g. of "Gruenfeld Defence".
+func familyAliases(family string) []string {
+	words := strings.Join(openingWords(family), " ")
+	for name, aliases := range openingFamilyAliases {
+		if strings.Join(openingWords(name), " ") == words {
+			return aliases
+		}
+	}
+	return nil
+}
+
+func containsWords(set map[string]bool, words []string) bool {
+	for _, word := range words {
+		if !set[word] {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *Report) MismatchReport() string {
+	data := [][]string{}
+	for _, mismatch := range r.Mismatches {
+		game := mismatch.Game
+		source := game.Tags["Link"]
+		if source == "" {
+			source = fmt.Sprintf("%s - %s, %s", game.Tags["White"], game.Tags["Black"], game.Tags["Date"])
+		}
+		tagOpening := game.Tags["ECO"]
+		if name := TagOpeningName(game); name != "" {
+			tagOpening += " " + name
+		}
+		data = append(data, []string{
+			source,
+			mismatch.Classification.ECO + " " + mismatch.Classification.Opening,
+			tagOpening,
+			FormatLine(mismatch.Classification.Node.Line()),
+		})
+	}
+	sort.Slice(data, func(i, j int) bool {
+		return data[i][1] < data[j][1]
+	})
+	b := bytes.NewBuffer([]byte{})
+	table := tablewriter.NewWriter(b)
+	table.SetHeader([]string{"Game", "scid.eco", "Tags", "Book line"})
+	table.AppendBulk(data)
+	table.SetRowLine(true)
+	table.Render()
+	return string(b.Bytes())
+}
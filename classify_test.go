@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+// Games with the tags chess.com and lichess set on them.
+const mismatchPGN = `[Site "Chess.com"]
+[ECO "C60"]
+[ECOUrl "https://www.chess.com/openings/Ruy-Lopez-Opening-Morphy-Defense-Closed-Variation"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Ba4 Nf6 5. O-O Be7 *
+
+[Site "https://lichess.org/abcdefgh"]
+[ECO "C84"]
+[Opening "Ruy Lopez: Closed"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 4. Ba4 Nf6 5. O-O Be7 *
+
+[Site "https://lichess.org/bcdefghi"]
+[ECO "D53"]
+[Opening "Queen's Gambit Declined: Modern Variation"]
+
+1. d4 d5 2. c4 e6 3. Nc3 Nf6 4. Bg5 Be7 *
+
+[Site "Chess.com"]
+[ECO "D06"]
+[ECOUrl "https://www.chess.com/openings/Queens-Gambit-Declined-3.Nc3-Nf6-4.Bg5"]
+
+1. d4 d5 2. c4 e6 3. Nc3 Nf6 4. Bg5 Be7 *
+
+[Site "https://lichess.org/cdefghij"]
+[ECO "D80"]
+[Opening "Grünfeld Defense"]
+
+1. d4 Nf6 2. c4 g6 3. Nc3 d5 *
+
+[Site "https://lichess.org/defghijk"]
+[ECO "A09"]
+[Opening "Réti Opening"]
+
+1. Nf3 d5 2. c4 *
+
+[Site "Chess.com"]
+[ECO "C42"]
+[ECOUrl "https://www.chess.com/openings/Petrovs-Defense-3.Nxe5"]
+
+1. e4 e5 2. Nf3 Nf6 3. Nxe5 *
+
+[Site "https://lichess.org/efghijkl"]
+[ECO "C33"]
+[Opening "King's Gambit Accepted"]
+
+1. e4 e5 2. f4 exf4 *
+
+[Site "https://lichess.org/fghijklm"]
+[ECO "C00"]
+[Opening "French Defense"]
+
+1. e4 c5 2. Nf3 d6 *
+
+[Site "Chess.com"]
+[ECO "B20"]
+[ECOUrl "https://www.chess.com/openings/French-Defense"]
+
+1. e4 c5 2. Nf3 d6 *
+`
+
+func TestIsClassificationMismatch(t *testing.T) {
+	content, err := ioutil.ReadFile("scid.eco")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree := NewMoveTree("", "Start position")
+	if err := tree.AddScidECO(string(content)); err != nil {
+		t.Fatal(err)
+	}
+	games, err := ParsePGN(mismatchPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []bool{false, false, false, false, false, false, false, false, true, true}
+	if len(games) != len(expected) {
+		t.Fatalf("Expected %d games, got %d", len(expected), len(games))
+	}
+	for i, game := range games {
+		classification := tree.Classify(game.Game)
+		if mismatch := IsClassificationMismatch(classification, game.Game); mismatch != expected[i] {
+			t.Errorf("Expected %s %s with %s %s to be a mismatch: %v, got %v", game.Tags["ECO"], TagOpeningName(game.Game),
+				classification.ECO, classification.Opening, expected[i], mismatch)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var clockRegexp = regexp.MustCompile(`\[%clk\s+(\d+):(\d+):(\d+(?:\.\d+)?)\]`)
+
+// ParseClock returns the seconds left on the clock in a comment like
+// "[%clk 0:02:59]" or "[%clk 0:02:59.8]".
+func ParseClock(comment string) (float64, bool) {
+	match := clockRegexp.FindStringSubmatch(comment)
+	if match == nil {
+		return 0, false
+	}
+	hours, _ := strconv.Atoi(match[1])
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.ParseFloat(match[3], 64)
+	return float64(hours*3600+minutes*60) + seconds, true
+}
+
+// ParseTimeControl returns the base time and increment in seconds of a
+// TimeControl tag like "180" or "300+3". Correspondence games ("1/86400")
+// and missing tags return false.
+func ParseTimeControl(timeControl string) (float64, float64, bool) {
+	fields := strings.SplitN(timeControl, "+", 2)
+	base, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil || base <= 0 {
+		return 0, 0, false
+	}
+	increment := 0.0
+	if len(fields) == 2 {
+		increment, err = strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0, 0, false
+		}
+	}
+	return base, increment, true
+}
+
+// TimeClass returns the speed of a game with the given TimeControl tag:
+// bullet, blitz, rapid or classical. Like lichess it's based on the
+// estimated duration, the base time plus 40 times the increment.
+// Correspondence games return daily and unknown time controls the empty
+// string.
+func TimeClass(timeControl string) string {
+	if strings.Contains(timeControl, "/") || timeControl == "-" {
+		return "daily"
+	}
+	base, increment, ok := ParseTimeControl(timeControl)
+	if !ok {
+		return ""
+	}
+	switch duration := base + 40*increment; {
+	case duration < 180:
+		return "bullet"
+	case duration < 480:
+		return "blitz"
+	case duration < 1500:
+		return "rapid"
+	}
+	return "classical"
+}
+
+// ClockUsage is the time usage of the player in a single game.
+type ClockUsage struct {
+	// The time control in seconds
+	Base      float64
+	Increment float64
+
+	// The seconds spent on the moves in the opening phase
+	OpeningTime float64
+	// The number of moves played with less than 10% of the base time left
+	LowClockMoves int
+	// The seconds left after the player's last book move
+	BookExitClock float64
+}
+
+// NewClockUsage returns the player's time usage in the game, based on the
+// [%clk] comments. The opening phase is the player's first openingMoves
+// moves and the book is left after bookPlies plies of the game. Games
+// without clock comments or with an unknown time control return nil.
+func NewClockUsage(game *Game, white bool, openingMoves, bookPlies int) *ClockUsage {
+	base, increment, ok := ParseTimeControl(game.Tags["TimeControl"])
+	if !ok {
+		return nil
+	}
+	usage := &ClockUsage{Base: base, Increment: increment, BookExitClock: base}
+	// games from a FEN can start with black to move
+	whiteStarts := len(strings.Fields(game.Tags["FEN"])) < 2 || strings.Fields(game.Tags["FEN"])[1] == "w"
+	first := 1
+	if white == whiteStarts {
+		first = 0
+	}
+	comments := game.Comments
+	previous := base
+	clocks := 0
+	for ply := first; ply < len(comments); ply += 2 {
+		clock, ok := ParseClock(comments[ply])
+		if !ok {
+			continue
+		}
+		clocks++
+		if ply/2 < openingMoves {
+			usage.OpeningTime += previous + increment - clock
+		}
+		if previous < base/10 {
+			usage.LowClockMoves++
+		}
+		if ply < bookPlies {
+			usage.BookExitClock = clock
+		}
+		previous = clock
+	}
+	if clocks == 0 {
+		return nil
+	}
+	return usage
+}
+
+// ClockStatistic aggregates the time usage in the games of an opening.
+type ClockStatistic struct {
+	Games         int
+	OpeningTime   float64
+	OpeningShare  float64
+	LowClockGames int
+	LowClockMoves int
+	BookExitShare float64
+}
+
+func NewClockStatistic() *ClockStatistic {
+	return &ClockStatistic{}
+}
+
+func (c *ClockStatistic) Count(usage *ClockUsage) {
+	c.Games += 1
+	c.OpeningTime += usage.OpeningTime
+	c.OpeningShare += usage.OpeningTime / usage.Base
+	if usage.LowClockMoves > 0 {
+		c.LowClockGames += 1
+	}
+	c.LowClockMoves += usage.LowClockMoves
+	c.BookExitShare += usage.BookExitClock / usage.Base
+}
+
+func (c *ClockStatistic) Headers() []string {
+	return []string{"Games", "Opening time", "Opening time %", "Games < 10%", "Moves < 10%", "Clock at book exit %"}
+}
+
+func (c *ClockStatistic) Data() []string {
+	games := float64(c.Games)
+	return []string{
+		fmt.Sprintf("%d", c.Games),
+		fmt.Sprintf("%.0fs", c.OpeningTime/games),
+		fmt.Sprintf("%.0f%%", 100*c.OpeningShare/games),
+		percentage(c.LowClockGames, c.Games),
+		fmt.Sprintf("%.1f", float64(c.LowClockMoves)/games),
+		fmt.Sprintf("%.0f%%", 100*c.BookExitShare/games),
+	}
+}
+
+// ClockReport shows the average time usage per opening, with the openings
+// that took the largest share of the clock first.
+func (r *Report) ClockReport(openingMoves int) string {
+	openings := []string{}
+	for opening := range r.Clocks {
+		openings = append(openings, opening)
+	}
+	sort.Slice(openings, func(i, j int) bool {
+		a, b := r.Clocks[openings[i]], r.Clocks[openings[j]]
+		shareA, shareB := a.OpeningShare/float64(a.Games), b.OpeningShare/float64(b.Games)
+		if shareA != shareB {
+			return shareA > shareB
+		}
+		return openings[i] < openings[j]
+	})
+	data := [][]string{}
+	total := NewClockStatistic()
+	for _, opening := range openings {
+		c := r.Clocks[opening]
+		data = append(data, append([]string{opening}, c.Data()...))
+		total.Games += c.Games
+		total.OpeningTime += c.OpeningTime
+		total.OpeningShare += c.OpeningShare
+		total.LowClockGames += c.LowClockGames
+		total.LowClockMoves += c.LowClockMoves
+		total.BookExitShare += c.BookExitShare
+	}
+	if total.Games > 0 {
+		data = append(data, append([]string{"Total"}, total.Data()...))
+	}
+	b := bytes.NewBuffer([]byte{})
+	RenderTable(b, fmt.Sprintf("Time usage in the first %d moves", openingMoves),
+		append([]string{"Opening"}, total.Headers()...), data)
+	return string(b.Bytes())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseClock(t *testing.T) {
+	for _, test := range []struct {
+		comment string
+		seconds float64
+		ok      bool
+	}{
+		{"[%clk 0:03:00]", 180, true},
+		{"[%clk 1:02:03]", 3723, true},
+		{"[%clk 0:00:09.8]", 9.8, true},
+		{"[%eval 0.25] [%clk 0:02:59]", 179, true},
+		{"[%clk  0:00:00]", 0, true},
+		{"[%eval 0.25]", 0, false},
+		{"[%clk 3:00]", 0, false},
+		{"", 0, false},
+	} {
+		seconds, ok := ParseClock(test.comment)
+		if ok != test.ok || math.Abs(seconds-test.seconds) > 1e-9 {
+			t.Errorf("Expected %v %v for %q, got %v %v", test.seconds, test.ok, test.comment, seconds, ok)
+		}
+	}
+}
+
+const clocksPGN = `[White "alice"]
+[Black "bob"]
+[TimeControl "180+2"]
+
+1. e4 { [%clk 0:03:00] } 1... e5 { [%clk 0:03:00] } 2. Nf3 { [%clk 0:02:55] } 2... Nc6 { [%clk 0:02:58] }
+3. Bb5 { [%clk 0:02:40] } 3... a6 { [%clk 0:02:50] } 4. Ba4 { [%clk 0:00:15] } 4... Nf6 { [%clk 0:02:40] }
+5. O-O { [%clk 0:00:10.5] } *
+
+[White "alice"]
+[Black "bob"]
+[TimeControl "180+2"]
+
+1. e4 e5 2. Nf3 Nc6 *
+
+[White "alice"]
+[Black "bob"]
+[TimeControl "-"]
+
+1. e4 { [%clk 0:03:00] } 1... e5 { [%clk 0:03:00] } *
+`
+
+func TestNewClockUsage(t *testing.T) {
+	games, err := ParsePGN(clocksPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		game                       int
+		white                      bool
+		openingMoves, bookPlies    int
+		openingTime, bookExitClock float64
+		lowClockMoves              int
+	}{
+		// 2 + 7 + 17 seconds on the first three moves, and the last move
+		// started with 15 of the 180 seconds
+		{0, true, 3, 5, 26, 160, 1},
+		{0, false, 3, 5, 16, 178, 0},
+		{0, true, 10, 5, 26 + 147 + 6.5, 160, 1},
+		// the clock is the base time if the game never was in book
+		{0, true, 3, 0, 26, 180, 1},
+		{0, false, 1, 10, 2, 160, 0},
+	} {
+		usage := NewClockUsage(games[test.game], test.white, test.openingMoves, test.bookPlies)
+		if usage == nil {
+			t.Errorf("Expected the clock usage of game %d", test.game)
+			continue
+		}
+		if math.Abs(usage.OpeningTime-test.openingTime) > 1e-9 || usage.BookExitClock != test.bookExitClock || usage.LowClockMoves != test.lowClockMoves {
+			t.Errorf("Expected opening time %v, book exit clock %v and %d low clock moves in game %d, got %+v",
+				test.openingTime, test.bookExitClock, test.lowClockMoves, test.game, usage)
+		}
+	}
+	// games without clock comments or time control
+	for _, game := range games[1:3] {
+		if usage := NewClockUsage(game, true, 10, 5); usage != nil {
+			t.Errorf("Expected no clock usage for %q, got %+v", game.Text, usage)
+		}
+	}
+}
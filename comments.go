@@ -0,0 +1,129 @@
+package main
+
+import (
+	"strings"
+)
+
+// ParseMoveComments returns the comments in the movetext of a game, per move
+// of the main line. Comments in variations are skipped.
+func ParseMoveComments(text string) []string {
+	comments := []string{}
+	depth := 0
+	for _, token := range TokenizeMovetext(text) {
+		switch {
+		case token == "(":
+			depth++
+		case token == ")":
+			depth--
+		case depth > 0:
+		case strings.HasPrefix(token, "{"):
+			if len(comments) == 0 {
+				continue
+			}
+			comment := strings.TrimSpace(token[1 : len(token)-1])
+			if comments[len(comments)-1] != "" {
+				comment = comments[len(comments)-1] + " " + comment
+			}
+			comments[len(comments)-1] = comment
+		default:
+			comments = append(comments, "")
+		}
+	}
+	return comments
+}
+
+// ParseMoveVariations returns the moves of the first variation after each
+// move of the main line, or nil for the moves without one. Such a variation
+// is played instead of the move, as in the lines lichess' analysis adds
+// after mistakes: 10. Qd2? { Bf4 was best. } (10. Bf4 Nf6 11. e3) 10... Nf6
+// Variations within the variation are skipped.
+func ParseMoveVariations(text string) [][]string {
+	variations := [][]string{}
+	depth := 0
+	current := -1
+	for _, token := range TokenizeMovetext(text) {
+		switch {
+		case token == "(":
+			depth++
+			if depth == 1 && len(variations) > 0 && variations[len(variations)-1] == nil {
+				current = len(variations) - 1
+				variations[current] = []string{}
+			}
+		case token == ")":
+			depth--
+			if depth == 0 {
+				current = -1
+			}
+		case strings.HasPrefix(token, "{"):
+		case depth == 0:
+			variations = append(variations, nil)
+		case depth == 1 && current >= 0:
+			variations[current] = append(variations[current], token)
+		}
+	}
+	return variations
+}
+
+// TokenizeMovetext splits the text of a game into its moves, comments
+// (including the braces) and the parentheses around variations. Tag pairs,
+// move numbers, NAGs, ; comments and the result are left out.
+func TokenizeMovetext(text string) []string {
+	tokens := []string{}
+	inTags := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inTags:
+			if c == ']' {
+				inTags = false
+			}
+		case c == '{':
+			end := strings.IndexByte(text[i:], '}')
+			if end < 0 {
+				end = len(text) - i - 1
+				tokens = append(tokens, text[i:]+"}")
+			} else {
+				tokens = append(tokens, text[i:i+end+1])
+			}
+			i += end
+		case c == ';':
+			end := strings.IndexByte(text[i:], '\n')
+			if end < 0 {
+				end = len(text) - i
+			}
+			i += end
+		case c == '[' && len(tokens) == 0:
+			inTags = true
+		case c == '(' || c == ')':
+			tokens = append(tokens, string(c))
+		case c == '$':
+			for i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9' {
+				i++
+			}
+		case isMoveStart(c):
+			end := i
+			for end < len(text) && !strings.ContainsRune(" \t\r\n{}();$", rune(text[end])) {
+				end++
+			}
+			if !isResult(text[i:end]) {
+				tokens = append(tokens, text[i:end])
+			}
+			i = end - 1
+		case c >= '0' && c <= '9':
+			// Move numbers like 1. and 1... and results like 1-0 are
+			// skipped, but a move can directly follow the number: 1.e4
+			for i+1 < len(text) && strings.IndexByte("0123456789./-", text[i+1]) >= 0 {
+				i++
+			}
+		}
+	}
+	return tokens
+}
+
+func isMoveStart(c byte) bool {
+	return c >= 'a' && c <= 'h' || strings.IndexByte("KQRBNO", c) >= 0
+}
+
+func isResult(s string) bool {
+	return s == "1-0" || s == "0-1" || s == "1/2-1/2" || s == "*"
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// ReportDiff compares the openings in two reports, e.g. for two periods or
+// two players.
+type ReportDiff struct {
+	Left      *Report
+	LeftName  string
+	Right     *Report
+	RightName string
+}
+
+// NewReportDiff compares two reports. The reports are named after their
+// player, followed by the (optional) period.
+func NewReportDiff(left *Report, leftPeriod string, right *Report, rightPeriod string) *ReportDiff {
+	name := func(r *Report, period string) string {
+		if period == "" {
+			return r.Player
+		}
+		return r.Player + " " + period
+	}
+	return &ReportDiff{
+		Left:      left,
+		LeftName:  name(left, leftPeriod),
+		Right:     right,
+		RightName: name(right, rightPeriod),
+	}
+}
+
+// DiffData returns the games played, score and the percentage of games
+// played with white for both statistics, and the differences between them.
+// Openings that only occur in one of the reports have a nil statistic for
+// the other, which results in empty cells.
+func DiffData(left, right *Statistic) []string {
+	if left != nil && left.TotalPlayed == 0 {
+		left = nil
+	}
+	if right != nil && right.TotalPlayed == 0 {
+		right = nil
+	}
+	games := func(s *Statistic) string {
+		if s == nil {
+			return ""
+		}
+		return fmt.Sprintf("%d", s.TotalPlayed)
+	}
+	score := func(s *Statistic) string {
+		if s == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.0f%%", s.Score())
+	}
+	white := func(s *Statistic) string {
+		if s == nil {
+			return ""
+		}
+		return fmt.Sprintf("%.0f%%", float64(s.Played[true])/float64(s.TotalPlayed)*100)
+	}
+	gamesDelta, scoreDelta, whiteDelta := "", "", ""
+	if left != nil && right != nil {
+		gamesDelta = fmt.Sprintf("%+d", right.TotalPlayed-left.TotalPlayed)
+		scoreDelta = fmt.Sprintf("%+.0f%%", right.Score()-left.Score())
+		whiteDelta = fmt.Sprintf("%+.0f%%", float64(right.Played[true])/float64(right.TotalPlayed)*100-float64(left.Played[true])/float64(left.TotalPlayed)*100)
+	} else if left != nil {
+		gamesDelta = fmt.Sprintf("%+d", -left.TotalPlayed)
+	} else if right != nil {
+		gamesDelta = fmt.Sprintf("%+d", right.TotalPlayed)
+	}
+	return []string{
+		games(left), games(right), gamesDelta,
+		score(left), score(right), scoreDelta,
+		white(left), white(right), whiteDelta,
+	}
+}
+
+func (d *ReportDiff) String() string {
+	openings := []string{}
+	for opening := range d.Left.OpeningStats {
+		openings = append(openings, opening)
+	}
+	for opening := range d.Right.OpeningStats {
+		if _, ok := d.Left.OpeningStats[opening]; !ok {
+			openings = append(openings, opening)
+		}
+	}
+	sort.Strings(openings)
+
+	b := bytes.NewBuffer([]byte{})
+	table := tablewriter.NewWriter(b)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader([]string{
+		"Opening",
+		"Games " + d.LeftName, "Games " + d.RightName, "Games +/-",
+		"Score " + d.LeftName, "Score " + d.RightName, "Score +/-",
+		"White " + d.LeftName, "White " + d.RightName, "White +/-",
+	})
+	for _, opening := range openings {
+		table.Append(append([]string{opening}, DiffData(d.Left.OpeningStats[opening], d.Right.OpeningStats[opening])...))
+	}
+	table.Append(append([]string{"Total"}, DiffData(d.Left.Statistic, d.Right.Statistic)...))
+	table.SetRowLine(true)
+	table.Render()
+	return string(b.Bytes())
+}
@@ -1,9 +1,59 @@
 package main
 
+import "strings"
+
+// LookupECO returns the code followed by the name of its ECO opening. Codes
+// can be extended (e.g. B90a), in which case the name of the basic code is
+// used. Some of the names in the ECOMap span a range of codes (e.g. A60-A79).
 func LookupECO(eco string) string {
 	if o, ok := ECOMap[eco]; ok {
 		return eco + " " + o
 	}
+	if len(eco) < 3 || eco[0] < 'A' || eco[0] > 'E' || strings.ContainsAny(eco, " -") {
+		return eco
+	}
+	basic := eco[:3]
+	if o, ok := ECOMap[basic]; ok {
+		return eco + " " + o
+	}
+	for codes, o := range ECOMap {
+		r := strings.Split(codes, "-")
+		if len(r) == 2 && r[0] <= basic && basic <= r[1] {
+			return eco + " " + o
+		}
+	}
+	return eco
+}
+
+// ECOFamilies are the five volumes of the Encyclopaedia of Chess Openings.
+var ECOFamilies = map[string]string{
+	"A": "Flank openings",
+	"B": "Semi-Open Games other than the French Defence",
+	"C": "Open Games and the French Defence",
+	"D": "Closed Games and Semi-Closed Games",
+	"E": "Indian Defences",
+}
+
+// ECOPrefix shortens an extended scid code (e.g. B90a1) to the family (B),
+// ECO code (B90), extension (B90a) or sub-variation (B90a1).
+func ECOPrefix(eco, groupBy string) string {
+	switch groupBy {
+	case "family":
+		if len(eco) >= 1 {
+			return eco[:1]
+		}
+	case "eco":
+		if len(eco) >= 3 {
+			return eco[:3]
+		}
+	case "extended":
+		if len(eco) >= 4 && eco[3] >= 'a' && eco[3] <= 'z' {
+			return eco[:4]
+		}
+		if len(eco) >= 3 {
+			return eco[:3]
+		}
+	}
 	return eco
 }
 
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// MateScore is the centipawn score used for a forced mate.
+const MateScore = 10000
+
+// Evaluation is an engine's assessment of a position, from white's
+// perspective.
+type Evaluation struct {
+	Centipawns int `json:"cp,omitempty"`
+	// Mate is the number of moves to a forced mate, negative if black
+	// mates, or 0 if there is none.
+	Mate int `json:"mate,omitempty"`
+	// BestMove and PV are in coordinate notation (e.g. e2e4).
+	BestMove string   `json:"best,omitempty"`
+	PV       []string `json:"pv,omitempty"`
+}
+
+// Score returns the evaluation in centipawns from the perspective of the
+// given side, counting a forced mate as MateScore.
+func (e *Evaluation) Score(white bool) int {
+	score := e.Centipawns
+	if e.Mate > 0 {
+		score = MateScore
+	} else if e.Mate < 0 {
+		score = -MateScore
+	}
+	if !white {
+		return -score
+	}
+	return score
+}
+
+func (e *Evaluation) String() string {
+	if e.Mate != 0 {
+		return fmt.Sprintf("#%d", e.Mate)
+	}
+	return fmt.Sprintf("%+.2f", float64(e.Centipawns)/100)
+}
+
+// EngineLimits configures how long the engine searches a position. Limits
+// that are 0 are not used; if several are set the engine stops at the
+// first one that is reached.
+type EngineLimits struct {
+	Depth    int
+	Nodes    int
+	MoveTime int // milliseconds
+}
+
+func (l EngineLimits) GoCommand() string {
+	command := "go"
+	if l.Depth > 0 {
+		command += fmt.Sprintf(" depth %d", l.Depth)
+	}
+	if l.Nodes > 0 {
+		command += fmt.Sprintf(" nodes %d", l.Nodes)
+	}
+	if l.MoveTime > 0 {
+		command += fmt.Sprintf(" movetime %d", l.MoveTime)
+	}
+	return command
+}
+
+// Engine talks to a UCI engine running as a child process. Evaluations are
+// cached by the limits and FEN and written to the cache file when the engine
+// is closed, so that positions are only analysed once across runs.
+type Engine struct {
+	Limits    EngineLimits
+	CachePath string
+	Cache     map[string]*Evaluation
+
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Scanner
+}
+
+// NewEngine starts the UCI engine at the given path and waits until it's
+// ready. If cachePath is not empty, earlier evaluations are read from it.
+func NewEngine(path string, limits EngineLimits, cachePath string) (*Engine, error) {
+	e := &Engine{
+		Limits:    limits,
+		CachePath: cachePath,
+		Cache:     map[string]*Evaluation{},
+		cmd:       exec.Command(path),
+	}
+	if cachePath != "" {
+		content, err := ioutil.ReadFile(cachePath)
+		if err == nil {
+			if err := json.Unmarshal(content, &e.Cache); err != nil {
+				return nil, fmt.Errorf("Invalid evaluation cache '%s': %s", cachePath, err.Error())
+			}
+		} else if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	var err error
+	if e.stdin, err = e.cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	stdout, err := e.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	e.stdout = bufio.NewScanner(stdout)
+	if err := e.cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Could not start engine '%s': %s", path, err.Error())
+	}
+	if err := e.handshake(); err != nil {
+		// don't leave the process running
+		e.cmd.Process.Kill()
+		e.cmd.Wait()
+		return nil, fmt.Errorf("Engine '%s' didn't start: %s", path, err.Error())
+	}
+	return e, nil
+}
+
+// handshake switches the engine to UCI and waits until it's ready.
+func (e *Engine) handshake() error {
+	if err := e.send("uci"); err != nil {
+		return err
+	}
+	if _, err := e.waitFor("uciok"); err != nil {
+		return err
+	}
+	if err := e.send("isready"); err != nil {
+		return err
+	}
+	_, err := e.waitFor("readyok")
+	return err
+}
+
+func (e *Engine) send(command string) error {
+	_, err := fmt.Fprintln(e.stdin, command)
+	return err
+}
+
+// waitFor reads the engine's output until a line starting with the given
+// token, returning the lines that were read, including that one.
+func (e *Engine) waitFor(token string) ([]string, error) {
+	lines := []string{}
+	for e.stdout.Scan() {
+		line := strings.TrimSpace(e.stdout.Text())
+		lines = append(lines, line)
+		if line == token || strings.HasPrefix(line, token+" ") {
+			return lines, nil
+		}
+	}
+	if err := e.stdout.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("Engine exited while waiting for '%s'", token)
+}
+
+// Evaluate returns the engine's evaluation of the position, from the cache
+// if it was analysed before.
+func (e *Engine) Evaluate(fen string) (*Evaluation, error) {
+	key := e.cacheKey(fen)
+	if evaluation, ok := e.Cache[key]; ok {
+		return evaluation, nil
+	}
+	if err := e.send("position fen " + fen); err != nil {
+		return nil, err
+	}
+	if err := e.send(e.Limits.GoCommand()); err != nil {
+		return nil, err
+	}
+	lines, err := e.waitFor("bestmove")
+	if err != nil {
+		return nil, err
+	}
+	evaluation := ParseUCIInfo(lines)
+	// UCI scores are from the perspective of the side to move
+	if fields := strings.Fields(fen); len(fields) > 1 && fields[1] == "b" {
+		evaluation.Centipawns = -evaluation.Centipawns
+		evaluation.Mate = -evaluation.Mate
+	}
+	e.Cache[key] = evaluation
+	return evaluation, nil
+}
+
+// cacheKey keys the evaluations by the limits as well, so that a deeper
+// search doesn't return the evaluations of a shallower one.
+func (e *Engine) cacheKey(fen string) string {
+	return e.Limits.GoCommand() + "|" + fen
+}
+
+// ParseUCIInfo returns the score and principal variation of the last info
+// line with a score, and the move of the bestmove line.
+func ParseUCIInfo(lines []string) *Evaluation {
+	evaluation := &Evaluation{}
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) > 1 && fields[0] == "bestmove" && fields[1] != "(none)" {
+			evaluation.BestMove = fields[1]
+		}
+		if len(fields) == 0 || fields[0] != "info" {
+			continue
+		}
+		for i := 1; i < len(fields)-2; i++ {
+			if fields[i] != "score" {
+				continue
+			}
+			value, err := strconv.Atoi(fields[i+2])
+			if err != nil {
+				continue
+			}
+			evaluation.Centipawns, evaluation.Mate, evaluation.PV = 0, 0, nil
+			if fields[i+1] == "mate" {
+				evaluation.Mate = value
+			} else {
+				evaluation.Centipawns = value
+			}
+			for j, field := range fields {
+				if field == "pv" {
+					evaluation.PV = append([]string{}, fields[j+1:]...)
+					break
+				}
+			}
+			break
+		}
+	}
+	return evaluation
+}
+
+// Close stops the engine and writes the cache.
+func (e *Engine) Close() error {
+	e.send("quit")
+	e.stdin.Close()
+	e.cmd.Wait()
+	if e.CachePath == "" {
+		return nil
+	}
+	content, err := json.MarshalIndent(e.Cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(e.CachePath, content, 0644)
+}
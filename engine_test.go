@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+const fakeEngine = "scripts/fake-uci-engine.sh"
+
+const afterE4 = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"
+
+func TestEngineEvaluate(t *testing.T) {
+	os.Setenv("FAKE_ENGINE_SCORE", "40")
+	os.Setenv("FAKE_ENGINE_MOVE", "e7e5")
+	defer os.Unsetenv("FAKE_ENGINE_SCORE")
+	defer os.Unsetenv("FAKE_ENGINE_MOVE")
+	cache := filepath.Join(t.TempDir(), "evaluations.json")
+	limits := EngineLimits{Depth: 5}
+
+	engine, err := NewEngine(fakeEngine, limits, cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluation, err := engine.Evaluate(afterE4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the score is from the side to move, so black's +0.40 is white's -0.40
+	if evaluation.Centipawns != -40 || evaluation.BestMove != "e7e5" || len(evaluation.PV) != 1 {
+		t.Errorf("Unexpected evaluation %+v", evaluation)
+	}
+	if err := engine.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(cache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := map[string]*Evaluation{}
+	if err := json.Unmarshal(content, &cached); err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 1 || cached["go depth 5|"+afterE4] == nil {
+		t.Errorf("Unexpected cache %s", content)
+	}
+
+	// the cached evaluation is only used with the same limits
+	os.Setenv("FAKE_ENGINE_SCORE", "10")
+	for _, test := range []struct {
+		limits     EngineLimits
+		centipawns int
+	}{
+		{EngineLimits{Depth: 5}, -40},
+		{EngineLimits{Depth: 10}, -10},
+	} {
+		engine, err := NewEngine(fakeEngine, test.limits, cache)
+		if err != nil {
+			t.Fatal(err)
+		}
+		evaluation, err := engine.Evaluate(afterE4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if evaluation.Centipawns != test.centipawns {
+			t.Errorf("Expected %d centipawns with %s, got %d", test.centipawns, test.limits.GoCommand(), evaluation.Centipawns)
+		}
+		if err := engine.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestNewEngineMissing(t *testing.T) {
+	if _, err := NewEngine("scripts/no-such-engine", EngineLimits{}, ""); err == nil {
+		t.Error("Expected an error for a missing engine")
+	}
+}
+
+// An engine that closes its output without answering is stopped instead of
+// being left running.
+func TestNewEngineStops(t *testing.T) {
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+	script := filepath.Join(dir, "engine.sh")
+	text := "#!/bin/sh\necho $$ > " + pidFile + "\nexec sleep 30 > /dev/null\n"
+	if err := ioutil.WriteFile(script, []byte(text), 0755); err != nil {
+		t.Fatal(err)
+	}
+	_, err := NewEngine(script, EngineLimits{}, "")
+	if err == nil || err.Error() != "Engine '"+script+"' didn't start: Engine exited while waiting for 'uciok'" {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	content, err := ioutil.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Kill(pid, 0); err != syscall.ESRCH {
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Errorf("Expected the engine to be stopped, got %v", err)
+	}
+}
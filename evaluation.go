@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+
+	"github.com/freeeve/pgn"
+)
+
+// MaxAverageScore caps the evaluations that are averaged per opening, so
+// that a single won or lost position doesn't outweigh all other games.
+const MaxAverageScore = 1000
+
+// EvaluationStatistic sums the player's evaluations at the book exit and at
+// a fixed ply in the games of an opening.
+type EvaluationStatistic struct {
+	BookExit      int
+	BookExitGames int
+	AtPly         int
+	AtPlyGames    int
+}
+
+func NewEvaluationStatistic() *EvaluationStatistic {
+	return &EvaluationStatistic{}
+}
+
+func capScore(score int) int {
+	if score > MaxAverageScore {
+		return MaxAverageScore
+	}
+	if score < -MaxAverageScore {
+		return -MaxAverageScore
+	}
+	return score
+}
+
+// Count adds the evaluations to the statistic. Either can be nil, e.g. when
+// the game ended before the fixed ply.
+func (e *EvaluationStatistic) Count(white bool, bookExit, atPly *Evaluation) {
+	if bookExit != nil {
+		e.BookExit += capScore(bookExit.Score(white))
+		e.BookExitGames += 1
+	}
+	if atPly != nil {
+		e.AtPly += capScore(atPly.Score(white))
+		e.AtPlyGames += 1
+	}
+}
+
+func (e *EvaluationStatistic) Add(other *EvaluationStatistic) {
+	e.BookExit += other.BookExit
+	e.BookExitGames += other.BookExitGames
+	e.AtPly += other.AtPly
+	e.AtPlyGames += other.AtPlyGames
+}
+
+func averageScore(sum, games int) string {
+	if games == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%+.2f", float64(sum)/float64(games)/100)
+}
+
+func (e *EvaluationStatistic) Data() []string {
+	return []string{
+		fmt.Sprintf("%d", e.BookExitGames),
+		averageScore(e.BookExit, e.BookExitGames),
+		fmt.Sprintf("%d", e.AtPlyGames),
+		averageScore(e.AtPly, e.AtPlyGames),
+	}
+}
+
+// CountEvaluations has the engine evaluate the position after the last book
+// move and after the given ply of the game.
+func (r *Report) CountEvaluations(opening string, white bool, game *pgn.Game, classification *Classification, ply int) error {
+	evaluate := func(plies int) (*Evaluation, error) {
+		b, ok := GameBoard(game, plies)
+		if !ok {
+			return nil, nil
+		}
+		return r.Engine.Evaluate(b.String())
+	}
+	bookExit, err := evaluate(classification.BookPlies)
+	if err != nil {
+		return err
+	}
+	atPly, err := evaluate(ply)
+	if err != nil {
+		return err
+	}
+	if _, ok := r.Evaluations[opening]; !ok {
+		r.Evaluations[opening] = NewEvaluationStatistic()
+	}
+	r.Evaluations[opening].Count(white, bookExit, atPly)
+	return nil
+}
+
+// EvaluationReport shows the average evaluation from the player's
+// perspective per opening, worst first.
+func (r *Report) EvaluationReport(ply int) string {
+	openings := []string{}
+	for opening := range r.Evaluations {
+		openings = append(openings, opening)
+	}
+	average := func(e *EvaluationStatistic) float64 {
+		if e.BookExitGames == 0 {
+			return 0
+		}
+		return float64(e.BookExit) / float64(e.BookExitGames)
+	}
+	sort.Slice(openings, func(i, j int) bool {
+		a, b := average(r.Evaluations[openings[i]]), average(r.Evaluations[openings[j]])
+		if a != b {
+			return a < b
+		}
+		return openings[i] < openings[j]
+	})
+	data := [][]string{}
+	total := NewEvaluationStatistic()
+	for _, opening := range openings {
+		data = append(data, append([]string{opening}, r.Evaluations[opening].Data()...))
+		total.Add(r.Evaluations[opening])
+	}
+	data = append(data, append([]string{"Total"}, total.Data()...))
+	move := fmt.Sprintf("Move %d", (ply+1)/2)
+	if ply%2 == 1 {
+		move += " (white)"
+	}
+	b := bytes.NewBuffer([]byte{})
+	RenderTable(b, "Average evaluation for "+r.Player+" in pawns",
+		[]string{"Opening", "Games", "Book exit", "Games", move}, data)
+	return string(b.Bytes())
+}
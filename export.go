@@ -0,0 +1,244 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// GameRecord is what the report derived from one of the player's games.
+type GameRecord struct {
+	Game  *Game
+	White bool
+	// Opening is the opening the game was counted under in the report.
+	Opening        string
+	Classification *Classification
+	// Clock is the player's time usage, or nil if the game has no clock
+	// comments.
+	Clock *ClockUsage
+}
+
+// ExportFormats are the supported formats of --mode export.
+var ExportFormats = map[string]string{
+	".csv":     "csv",
+	".db":      "sqlite",
+	".sqlite":  "sqlite",
+	".sqlite3": "sqlite",
+}
+
+// ExportFormat returns the format of the file based on its extension, or
+// the empty string if it's not known.
+func ExportFormat(path string) string {
+	return ExportFormats[strings.ToLower(filepath.Ext(path))]
+}
+
+// ExportColumns are the columns with the derived fields of a game, followed
+// in the export by a column per PGN tag.
+var ExportColumns = []string{
+	"id", "player", "colour", "outcome", "score", "opponent", "player_elo", "opponent_elo",
+	"date", "time_control", "plies", "termination", "opening", "eco", "eco_name", "book_plies",
+	"deviation", "deviated_by", "opening_time", "low_clock_moves", "book_exit_clock",
+}
+
+// exportSchema creates the tables of the SQLite export. The exported_games
+// table has a row per game with the ExportColumns, and the exported_tags
+// table has a row per game and PGN tag. The names are distinct from the
+// tables of the GameStore, so that other tables in the file are left alone.
+const exportSchema = `
+DROP TABLE IF EXISTS exported_tags;
+DROP TABLE IF EXISTS exported_games;
+CREATE TABLE exported_games (
+	id              TEXT PRIMARY KEY, -- the game's URL or a hash of its PGN, see GameID
+	player          TEXT NOT NULL,
+	colour          TEXT NOT NULL,    -- the player's colour: white or black
+	outcome         TEXT NOT NULL,    -- for the player: Won, Drawn or Lost
+	score           REAL NOT NULL,    -- for the player: 1, 0.5 or 0
+	opponent        TEXT NOT NULL,
+	player_elo      INTEGER,
+	opponent_elo    INTEGER,
+	date            TEXT NOT NULL,    -- YYYY-MM-DD, the UTCDate or Date tag
+	time_control    TEXT NOT NULL,
+	plies           INTEGER NOT NULL,
+	termination     TEXT NOT NULL,    -- see TerminationMethod
+	opening         TEXT NOT NULL,    -- the opening the report counted the game under
+	eco             TEXT NOT NULL,    -- the scid code of the last book position
+	eco_name        TEXT NOT NULL,    -- the name of the last book position
+	book_plies      INTEGER,          -- the plies played in book
+	deviation       TEXT NOT NULL,    -- the first move out of book, in SAN
+	deviated_by     TEXT NOT NULL,    -- player or opponent
+	opening_time    REAL,             -- the player's seconds spent on the opening moves
+	low_clock_moves INTEGER,          -- the player's moves with less than 10% of the base time
+	book_exit_clock REAL              -- the player's seconds left after the last book move
+);
+CREATE TABLE exported_tags (
+	game_id TEXT NOT NULL REFERENCES exported_games (id),
+	name    TEXT NOT NULL,
+	value   TEXT NOT NULL,
+	PRIMARY KEY (game_id, name)
+);
+`
+
+// ID identifies the game as in the GameStore.
+func (g *GameRecord) ID() string {
+	return GameID(g.Game.Game, g.Game.Text)
+}
+
+// Values returns the values of the ExportColumns. Unknown values are nil.
+func (g *GameRecord) Values(player string) []interface{} {
+	result := g.Game.Tags["Result"]
+	date := ""
+	if d, ok := GameDate(g.Game.Game); ok {
+		date = d.Format("2006-01-02")
+	}
+	values := []interface{}{
+		g.ID(),
+		player,
+		strings.ToLower(colourName(g.White)),
+		Outcome(g.White, result),
+		Score(g.White, result),
+		Opponent(g.Game.Game, player),
+		nullInt(PlayerElo(g.Game.Game, player)),
+		nullInt(OpponentElo(g.Game.Game, player)),
+		date,
+		g.Game.Tags["TimeControl"],
+		len(g.Game.Moves),
+		TerminationMethod(g.Game.Game),
+		g.Opening,
+	}
+	c := g.Classification
+	if c != nil && c.Node != nil {
+		deviation, deviatedBy := "", ""
+		if c.LeftBook() {
+			deviation = moveSAN(c.Node.Board(), c.Deviation)
+			deviatedBy = "opponent"
+			if c.DeviatedByWhite() == g.White {
+				deviatedBy = "player"
+			}
+		}
+		values = append(values, c.ECO, c.Opening, c.BookPlies, deviation, deviatedBy)
+	} else {
+		values = append(values, "", "", nil, "", "")
+	}
+	if g.Clock != nil {
+		values = append(values, g.Clock.OpeningTime, g.Clock.LowClockMoves, g.Clock.BookExitClock)
+	} else {
+		values = append(values, nil, nil, nil)
+	}
+	return values
+}
+
+// SameFile returns whether both paths name the same file, which doesn't
+// need to exist yet.
+func SameFile(a, b string) bool {
+	if filepath.Clean(a) == filepath.Clean(b) {
+		return true
+	}
+	infoA, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	infoB, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(infoA, infoB)
+}
+
+func nullInt(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+// ExportTags returns the names of all the tags in the games, sorted.
+func ExportTags(records []*GameRecord) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, record := range records {
+		for tag := range record.Game.Tags {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// WriteGamesCSV writes a row per game with the ExportColumns and a column
+// per PGN tag.
+func WriteGamesCSV(w io.Writer, player string, records []*GameRecord) error {
+	tags := ExportTags(records)
+	out := csv.NewWriter(w)
+	if err := out.Write(append(append([]string{}, ExportColumns...), tags...)); err != nil {
+		return err
+	}
+	for _, record := range records {
+		row := []string{}
+		for _, value := range record.Values(player) {
+			if value == nil {
+				row = append(row, "")
+			} else {
+				row = append(row, fmt.Sprint(value))
+			}
+		}
+		for _, tag := range tags {
+			row = append(row, record.Game.Tags[tag])
+		}
+		if err := out.Write(row); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// WriteGamesSQLite writes the games to the exported_games and exported_tags
+// tables of a SQLite file, replacing the tables if they exist. Games that
+// occur more than once are only written once.
+func WriteGamesSQLite(path, player string, records []*GameRecord) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if err := writeGames(tx, player, records); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func writeGames(tx *sql.Tx, player string, records []*GameRecord) error {
+	if _, err := tx.Exec(exportSchema); err != nil {
+		return err
+	}
+	insertGame := fmt.Sprintf("INSERT OR IGNORE INTO exported_games (%s) VALUES (?%s)",
+		strings.Join(ExportColumns, ", "), strings.Repeat(", ?", len(ExportColumns)-1))
+	for _, record := range records {
+		result, err := tx.Exec(insertGame, record.Values(player)...)
+		if err != nil {
+			return err
+		}
+		if inserted, err := result.RowsAffected(); err != nil || inserted == 0 {
+			continue
+		}
+		for name, value := range record.Game.Tags {
+			if _, err := tx.Exec("INSERT INTO exported_tags (game_id, name, value) VALUES (?, ?, ?)", record.ID(), name, value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
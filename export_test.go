@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+)
+
+func TestWriteGamesSQLite(t *testing.T) {
+	games, err := ParsePGN(`[White "alice"]
+[Black "bob"]
+[Date "2020.01.01"]
+[Round "-"]
+[Result "1-0"]
+
+1. e4 e5 1-0
+
+[White "alice"]
+[Black "bob"]
+[Date "2020.01.01"]
+[Round "-"]
+[Result "0-1"]
+
+1. d4 d5 0-1
+`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := []*GameRecord{}
+	for _, game := range games {
+		records = append(records, &GameRecord{Game: game, White: true})
+	}
+
+	path := filepath.Join(t.TempDir(), "games.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec("CREATE TABLE games (id TEXT); INSERT INTO games VALUES ('mine')"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteGamesSQLite(path, "alice", records); err != nil {
+		t.Fatal(err)
+	}
+	var exported, other int
+	if err := db.QueryRow("SELECT COUNT(DISTINCT id) FROM exported_games").Scan(&exported); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.QueryRow("SELECT COUNT(*) FROM games").Scan(&other); err != nil {
+		t.Fatal(err)
+	}
+	// the games have the same players, date and round
+	if exported != 2 {
+		t.Errorf("Expected 2 exported games, got %d", exported)
+	}
+	if other != 1 {
+		t.Errorf("Expected the games table to be left alone, got %d rows", other)
+	}
+}
+
+func TestReportKeepsGamesToExport(t *testing.T) {
+	classifier := filterTestClassifier(t)
+	game := filterTestGame(t)
+	defer func(mode string) { *Mode = mode }(*Mode)
+	for _, test := range []struct {
+		mode  string
+		games int
+	}{
+		{"report", 0},
+		{"export", 1},
+		{"puzzles", 1},
+	} {
+		*Mode = test.mode
+		report := NewReport("alice")
+		if err := report.Count(classifier, game, classifier.Classify(game.Game)); err != nil {
+			t.Fatal(err)
+		}
+		if len(report.Games) != test.games {
+			t.Errorf("Expected %d game(s) to be kept in %s mode, got %d", test.games, test.mode, len(report.Games))
+		}
+	}
+}
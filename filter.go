@@ -0,0 +1,449 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/freeeve/pgn"
+)
+
+// Filter selects games with an expression like
+//
+//	color = white and tc = blitz and opp_elo > 1800 and date >= 2020-01 and opening ~ "Sicilian"
+//
+// Comparisons are combined with and, or, not and parentheses. A field is
+// either one of the FilterFields, which are lowercase, or a PGN tag, which
+// is written as in the PGN, e.g. WhiteElo. The operators are =, !=, <, <=,
+// >, >=, ~ (contains) and !~ (doesn't contain). Values are compared as
+// numbers if both sides are numbers and otherwise as case insensitive
+// strings. Dates are compared up to the length of the value, so
+// date = 2020-01 matches all games played in January 2020. Missing values
+// are empty.
+type Filter struct {
+	Expression string
+	root       filterNode
+}
+
+// filterGame is a game a filter is evaluated on.
+type filterGame struct {
+	game           *pgn.Game
+	player         string
+	classification *Classification
+}
+
+// FilterFields are the fields derived from the games, relative to the
+// player.
+var FilterFields = map[string]func(g *filterGame) string{
+	"color": func(g *filterGame) string {
+		if !playsGame(g.game, g.player) {
+			return ""
+		}
+		return strings.ToLower(colourName(PlaysWhite(g.game, g.player)))
+	},
+	"outcome": func(g *filterGame) string {
+		if !playsGame(g.game, g.player) {
+			return ""
+		}
+		return strings.ToLower(Outcome(PlaysWhite(g.game, g.player), g.game.Tags["Result"]))
+	},
+	"opponent": func(g *filterGame) string {
+		return Opponent(g.game, g.player)
+	},
+	"elo": func(g *filterGame) string {
+		return ratingField(PlayerElo(g.game, g.player))
+	},
+	"opp_elo": func(g *filterGame) string {
+		return ratingField(OpponentElo(g.game, g.player))
+	},
+	"date": func(g *filterGame) string {
+		if date, ok := GameDate(g.game); ok {
+			return date.Format("2006-01-02")
+		}
+		return ""
+	},
+	"tc": func(g *filterGame) string {
+		return TimeClass(g.game.Tags["TimeControl"])
+	},
+	"termination": func(g *filterGame) string {
+		return TerminationMethod(g.game)
+	},
+	"plies": func(g *filterGame) string {
+		return strconv.Itoa(len(g.game.Moves))
+	},
+	"opening": func(g *filterGame) string {
+		return ReportOpening(g.classification, g.game)
+	},
+	"eco": func(g *filterGame) string {
+		return g.classification.ECO
+	},
+	"book_plies": func(g *filterGame) string {
+		return strconv.Itoa(g.classification.BookPlies)
+	},
+}
+
+// filterAliases are alternative names of the FilterFields.
+var filterAliases = map[string]string{
+	"colour":       "color",
+	"time":         "tc",
+	"opponent_elo": "opp_elo",
+}
+
+func playsGame(game *pgn.Game, player string) bool {
+	return game.Tags["White"] == player || game.Tags["Black"] == player
+}
+
+func ratingField(rating int) string {
+	if rating == 0 {
+		return ""
+	}
+	return strconv.Itoa(rating)
+}
+
+// ParseFilter parses a filter expression.
+func ParseFilter(expression string) (*Filter, error) {
+	tokens, err := lexFilter(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{expression: expression, tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != filterEnd {
+		return nil, p.errorf(token, "expected and, or or the end of the filter, found %s", token)
+	}
+	return &Filter{Expression: expression, root: root}, nil
+}
+
+// ReadFilter reads a filter expression from a file. The expression can span
+// multiple lines, and everything after a # on a line is a comment.
+func ReadFilter(path string) (*Filter, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := ParseFilter(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err.Error())
+	}
+	return filter, nil
+}
+
+// Match returns whether the player's game matches the filter. The
+// classification of the game is used for the opening fields. A nil filter
+// matches every game.
+func (f *Filter) Match(game *pgn.Game, player string, classification *Classification) bool {
+	if f == nil {
+		return true
+	}
+	return f.root.match(&filterGame{game: game, player: player, classification: classification})
+}
+
+// And returns a filter that matches the games matching both filters. Either
+// can be nil.
+func (f *Filter) And(other *Filter) *Filter {
+	if f == nil {
+		return other
+	} else if other == nil {
+		return f
+	}
+	return &Filter{
+		Expression: "(" + f.Expression + ") and (" + other.Expression + ")",
+		root:       &filterAnd{f.root, other.root},
+	}
+}
+
+func (f *Filter) String() string {
+	return f.Expression
+}
+
+type filterNode interface {
+	match(g *filterGame) bool
+}
+
+type filterAnd struct {
+	left, right filterNode
+}
+
+func (n *filterAnd) match(g *filterGame) bool {
+	return n.left.match(g) && n.right.match(g)
+}
+
+type filterOr struct {
+	left, right filterNode
+}
+
+func (n *filterOr) match(g *filterGame) bool {
+	return n.left.match(g) || n.right.match(g)
+}
+
+type filterNot struct {
+	node filterNode
+}
+
+func (n *filterNot) match(g *filterGame) bool {
+	return !n.node.match(g)
+}
+
+type filterComparison struct {
+	field    string
+	operator string
+	value    string
+}
+
+func (n *filterComparison) match(g *filterGame) bool {
+	value := g.game.Tags[n.field]
+	if field, ok := FilterFields[n.field]; ok {
+		value = field(g)
+	}
+	if n.field == "date" && len(n.value) < len(value) {
+		value = value[:len(n.value)]
+	}
+	switch n.operator {
+	case "~":
+		return strings.Contains(strings.ToLower(value), strings.ToLower(n.value))
+	case "!~":
+		return !strings.Contains(strings.ToLower(value), strings.ToLower(n.value))
+	}
+	cmp := 0
+	a, errA := strconv.ParseFloat(value, 64)
+	b, errB := strconv.ParseFloat(n.value, 64)
+	if errA == nil && errB == nil {
+		if a < b {
+			cmp = -1
+		} else if a > b {
+			cmp = 1
+		}
+	} else {
+		cmp = strings.Compare(strings.ToLower(value), strings.ToLower(n.value))
+	}
+	switch n.operator {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
+
+type filterTokenKind int
+
+const (
+	filterWord filterTokenKind = iota
+	filterString
+	filterOperator
+	filterOpen
+	filterClose
+	filterEnd
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	// offset is the position of the token in the expression
+	offset int
+}
+
+func (t filterToken) String() string {
+	switch t.kind {
+	case filterEnd:
+		return "the end of the filter"
+	case filterString:
+		return strconv.Quote(t.text)
+	}
+	return "'" + t.text + "'"
+}
+
+// isKeyword returns whether the token is the given keyword, which are case
+// insensitive.
+func (t filterToken) isKeyword(keyword string) bool {
+	return t.kind == filterWord && strings.EqualFold(t.text, keyword)
+}
+
+func isFilterWordChar(c rune) bool {
+	return unicode.IsLetter(c) || unicode.IsDigit(c) || strings.ContainsRune("_-.:/+*", c)
+}
+
+func lexFilter(expression string) ([]filterToken, error) {
+	tokens := []filterToken{}
+	for i := 0; i < len(expression); {
+		c, size := utf8.DecodeRuneInString(expression[i:])
+		switch {
+		case unicode.IsSpace(c):
+			i += size
+		case c == '#':
+			for i < len(expression) && expression[i] != '\n' {
+				i++
+			}
+		case c == '(':
+			tokens = append(tokens, filterToken{filterOpen, "(", i})
+			i++
+		case c == ')':
+			tokens = append(tokens, filterToken{filterClose, ")", i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(expression[i+1:], '"')
+			if end < 0 {
+				return nil, filterError(expression, i, "unterminated string")
+			}
+			tokens = append(tokens, filterToken{filterString, expression[i+1 : i+1+end], i})
+			i += end + 2
+		case strings.ContainsRune("=<>!~", c):
+			operator := string(c)
+			if i+1 < len(expression) && (c == '<' || c == '>' || c == '!') && expression[i+1] == '=' ||
+				c == '!' && i+1 < len(expression) && expression[i+1] == '~' {
+				operator += string(expression[i+1])
+			}
+			if operator == "!" {
+				return nil, filterError(expression, i, "unknown operator '!', did you mean != or !~?")
+			}
+			tokens = append(tokens, filterToken{filterOperator, operator, i})
+			i += len(operator)
+		case isFilterWordChar(c):
+			start := i
+			for i < len(expression) {
+				c, size := utf8.DecodeRuneInString(expression[i:])
+				if !isFilterWordChar(c) {
+					break
+				}
+				i += size
+			}
+			tokens = append(tokens, filterToken{filterWord, expression[start:i], start})
+		default:
+			return nil, filterError(expression, i, fmt.Sprintf("unexpected character '%c'", c))
+		}
+	}
+	return append(tokens, filterToken{filterEnd, "", len(expression)}), nil
+}
+
+// filterError returns an error pointing at the offset in the expression.
+// The column counts characters rather than bytes.
+func filterError(expression string, offset int, message string) error {
+	line := strings.Count(expression[:offset], "\n") + 1
+	column := utf8.RuneCountInString(expression[strings.LastIndex(expression[:offset], "\n")+1:offset]) + 1
+	if strings.Contains(strings.TrimRight(expression, "\n"), "\n") {
+		return fmt.Errorf("Invalid filter at line %d, column %d: %s", line, column, message)
+	}
+	return fmt.Errorf("Invalid filter at column %d: %s", column, message)
+}
+
+type filterParser struct {
+	expression string
+	tokens     []filterToken
+	position   int
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.position]
+}
+
+func (p *filterParser) next() filterToken {
+	token := p.tokens[p.position]
+	if token.kind != filterEnd {
+		p.position++
+	}
+	return token
+}
+
+func (p *filterParser) errorf(token filterToken, format string, args ...interface{}) error {
+	return filterError(p.expression, token.offset, fmt.Sprintf(format, args...))
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().isKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &filterAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseNot() (filterNode, error) {
+	if p.peek().isKeyword("not") {
+		p.next()
+		node, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &filterNot{node}, nil
+	}
+	if p.peek().kind == filterOpen {
+		p.next()
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token := p.next(); token.kind != filterClose {
+			return nil, p.errorf(token, "expected ), found %s", token)
+		}
+		return node, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	field := p.next()
+	if field.kind != filterWord || field.isKeyword("and") || field.isKeyword("or") {
+		return nil, p.errorf(field, "expected a field, found %s", field)
+	}
+	name := field.text
+	if alias, ok := filterAliases[name]; ok {
+		name = alias
+	}
+	if first, _ := utf8.DecodeRuneInString(name); !unicode.IsUpper(first) && FilterFields[name] == nil {
+		return nil, p.errorf(field, "unknown field '%s'. The fields are %s, or a PGN tag like WhiteElo", field.text, filterFieldNames())
+	}
+	operator := p.next()
+	if operator.kind != filterOperator {
+		return nil, p.errorf(operator, "expected an operator (=, !=, <, <=, >, >=, ~, !~) after '%s', found %s", field.text, operator)
+	}
+	value := p.next()
+	if value.kind != filterWord && value.kind != filterString {
+		return nil, p.errorf(value, "expected a value after '%s', found %s", operator.text, value)
+	}
+	return &filterComparison{field: name, operator: operator.text, value: value.text}, nil
+}
+
+func filterFieldNames() string {
+	names := []string{}
+	for name := range FilterFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
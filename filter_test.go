@@ -0,0 +1,125 @@
+package main
+
+import (
+	"testing"
+)
+
+const filterPGN = `[White "alice"]
+[Black "Müller"]
+[Result "1-0"]
+[Date "2020.01.15"]
+[WhiteElo "1950"]
+[BlackElo "800"]
+[TimeControl "180+0"]
+[Round "10"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0`
+
+func filterTestGame(t *testing.T) *Game {
+	games, err := ParsePGN(filterPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return games[0]
+}
+
+func filterTestClassifier(t *testing.T) *MoveTree {
+	tree := NewMoveTree("", "Start position")
+	err := tree.AddLichessTSV("eco\tname\tpgn\nC20\tKing's Pawn Game\t1. e4 e5\nC60\tRuy Lopez\t1. e4 e5 2. Nf3 Nc6 3. Bb5\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestFilterMatch(t *testing.T) {
+	game := filterTestGame(t)
+	classifier := filterTestClassifier(t)
+	for _, test := range []struct {
+		expression string
+		match      bool
+	}{
+		// precedence: not binds tighter than and, and tighter than or
+		{"color = black or color = white and outcome = won", true},
+		{"color = black and outcome = won or color = white", true},
+		{"(color = black or color = white) and outcome = lost", false},
+		{"color = black or color = white and outcome = lost", false},
+		{"not color = black and outcome = won", true},
+		{"not (color = white and outcome = won)", false},
+		{"not color = white or outcome = won", true},
+		// dates are compared up to the length of the value
+		{"date = 2020", true},
+		{"date = 2020-01", true},
+		{"date = 2020-02", false},
+		{"date >= 2020-01 and date < 2020-02", true},
+		{"date > 2020-01", false},
+		{"date = 2020-01-15", true},
+		// numbers are compared as numbers, other values as strings
+		{"opp_elo > 799", true},
+		{"opp_elo < 1000", true},
+		{"elo > 800", true},
+		{"Round > 9", true},
+		{"Round > 9x", false},
+		{"WhiteElo = 1950.0", true},
+		{"plies = 6", true},
+		{"tc = BLITZ", true},
+		{"Missing = \"\"", true},
+		// strings can contain any character
+		{"opponent = Müller", true},
+		{"opponent ~ ü", true},
+		{"opponent = \"MÜLLER\"", true},
+		{"opponent !~ mül", false},
+		// the opening fields classify the game
+		{"opening ~ Ruy and eco = C60 and book_plies = 5", true},
+		{"opening = \"King's Pawn Game\"", false},
+	} {
+		filter, err := ParseFilter(test.expression)
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", test.expression, err)
+			continue
+		}
+		if match := filter.Match(game.Game, "alice", classifier.Classify(game.Game)); match != test.match {
+			t.Errorf("Expected %q to match: %v, got %v", test.expression, test.match, match)
+		}
+	}
+}
+
+func TestFilterOpening(t *testing.T) {
+	classifier := filterTestClassifier(t)
+	games, err := ParsePGN("[White \"alice\"]\n\n1. e4 e5 2. Nf3 Nc6 3. Bb5 *\n\n[White \"alice\"]\n\n1. d4 d5 *\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the opening is the name the game is reported under
+	for i, opening := range []string{"Ruy Lopez", "Unknown opening"} {
+		filter, err := ParseFilter("opening = \"" + opening + "\"")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !filter.Match(games[i].Game, "alice", classifier.Classify(games[i].Game)) {
+			t.Errorf("Expected game %d to be reported under %s", i+1, opening)
+		}
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	for _, test := range []struct {
+		expression, err string
+	}{
+		{"color = white and", "Invalid filter at column 18: expected a field, found the end of the filter"},
+		{"color white", "Invalid filter at column 7: expected an operator (=, !=, <, <=, >, >=, ~, !~) after 'color', found 'white'"},
+		{"color =", "Invalid filter at column 8: expected a value after '=', found the end of the filter"},
+		{"colr = white", "Invalid filter at column 1: unknown field 'colr'. The fields are book_plies, color, date, eco, elo, opening, opp_elo, opponent, outcome, plies, tc, termination, or a PGN tag like WhiteElo"},
+		{"opponent ! x", "Invalid filter at column 10: unknown operator '!', did you mean != or !~?"},
+		{"opponent = \"x", "Invalid filter at column 12: unterminated string"},
+		{"opponent = Müller & x", "Invalid filter at column 19: unexpected character '&'"},
+		{"opponent = Müller €", "Invalid filter at column 19: unexpected character '€'"},
+		{"(color = white", "Invalid filter at column 15: expected ), found the end of the filter"},
+		{"color = white\nand (elo > 1\n", "Invalid filter at line 3, column 1: expected ), found the end of the filter"},
+	} {
+		_, err := ParseFilter(test.expression)
+		if err == nil || err.Error() != test.err {
+			t.Errorf("Expected error %q for %q, got %v", test.err, test.expression, err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/freeeve/pgn"
+)
+
+// PlaysWhite returns whether the player had the white pieces.
+func PlaysWhite(game *pgn.Game, player string) bool {
+	return game.Tags["White"] == player
+}
+
+// Opponent returns the name of the player's opponent.
+func Opponent(game *pgn.Game, player string) string {
+	if PlaysWhite(game, player) {
+		return game.Tags["Black"]
+	}
+	return game.Tags["White"]
+}
+
+// PlayerElo returns the player's rating, or 0 if the game wasn't rated.
+func PlayerElo(game *pgn.Game, player string) int {
+	if PlaysWhite(game, player) {
+		return elo(game.Tags["WhiteElo"])
+	}
+	return elo(game.Tags["BlackElo"])
+}
+
+// OpponentElo returns the rating of the player's opponent, or 0 if the game
+// wasn't rated.
+func OpponentElo(game *pgn.Game, player string) int {
+	if PlaysWhite(game, player) {
+		return elo(game.Tags["BlackElo"])
+	}
+	return elo(game.Tags["WhiteElo"])
+}
+
+func elo(tag string) int {
+	rating, err := strconv.Atoi(tag)
+	if err != nil {
+		return 0
+	}
+	return rating
+}
+
+// GameDate returns the date the game was played, preferring the UTCDate
+// tag over the Date tag. The second return value is false if neither tag
+// contains a complete date.
+func GameDate(game *pgn.Game) (time.Time, bool) {
+	for _, tag := range []string{"UTCDate", "Date"} {
+		date, err := time.Parse("2006.01.02", game.Tags[tag])
+		if err == nil {
+			return date, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// GameLink returns the URL of the game on the site it was played on, or the
+// empty string if it's not known.
+func GameLink(game *pgn.Game) string {
+	if link := game.Tags["Link"]; link != "" {
+		return link
+	}
+	if strings.HasPrefix(game.Tags["Site"], "http") {
+		return game.Tags["Site"]
+	}
+	return ""
+}
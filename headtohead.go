@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// HeadToHead keeps track of the games against a single opponent.
+type HeadToHead struct {
+	Opponent  string
+	Statistic *Statistic
+	Openings  map[string]*Statistic
+
+	// The sum of the rating differences (opponent - player) in the games
+	// where both players were rated.
+	RatingDifference int
+	RatedGames       int
+}
+
+func NewHeadToHead(opponent string) *HeadToHead {
+	return &HeadToHead{
+		Opponent:  opponent,
+		Statistic: NewStatistic(),
+		Openings:  map[string]*Statistic{},
+	}
+}
+
+func (h *HeadToHead) Count(white bool, gameResult, opening string, game *pgn.Game, player string) {
+	h.Statistic.Count(white, gameResult)
+	if _, ok := h.Openings[opening]; !ok {
+		h.Openings[opening] = NewStatistic()
+	}
+	h.Openings[opening].Count(white, gameResult)
+
+	playerElo, opponentElo := PlayerElo(game, player), OpponentElo(game, player)
+	if playerElo > 0 && opponentElo > 0 {
+		h.RatingDifference += opponentElo - playerElo
+		h.RatedGames += 1
+	}
+}
+
+// SortedOpenings returns the openings played against the opponent, most
+// played first.
+func (h *HeadToHead) SortedOpenings() []string {
+	openings := []string{}
+	for opening := range h.Openings {
+		openings = append(openings, opening)
+	}
+	sort.Slice(openings, func(i, j int) bool {
+		a, b := h.Openings[openings[i]], h.Openings[openings[j]]
+		if a.TotalPlayed != b.TotalPlayed {
+			return a.TotalPlayed > b.TotalPlayed
+		}
+		return openings[i] < openings[j]
+	})
+	return openings
+}
+
+func (h *HeadToHead) Data() []string {
+	ratingDifference := ""
+	if h.RatedGames > 0 {
+		ratingDifference = fmt.Sprintf("%+d", h.RatingDifference/h.RatedGames)
+	}
+	openings := h.SortedOpenings()
+	if len(openings) > 3 {
+		openings = openings[:3]
+	}
+	return []string{
+		h.Opponent,
+		fmt.Sprintf("%d", h.Statistic.TotalPlayed),
+		fmt.Sprintf("%.0f%%", h.Statistic.Score()),
+		percentage(h.Statistic.Played[true], h.Statistic.TotalPlayed),
+		percentage(h.Statistic.Played[false], h.Statistic.TotalPlayed),
+		ratingDifference,
+		strings.Join(openings, ", "),
+	}
+}
+
+// HeadToHeadReport lists the opponents that were played at least minGames
+// times, most played first.
+func (r *Report) HeadToHeadReport(minGames int) string {
+	opponents := []*HeadToHead{}
+	for _, h := range r.HeadToHeads {
+		if h.Statistic.TotalPlayed >= minGames {
+			opponents = append(opponents, h)
+		}
+	}
+	sort.Slice(opponents, func(i, j int) bool {
+		if opponents[i].Statistic.TotalPlayed != opponents[j].Statistic.TotalPlayed {
+			return opponents[i].Statistic.TotalPlayed > opponents[j].Statistic.TotalPlayed
+		}
+		return opponents[i].Opponent < opponents[j].Opponent
+	})
+	data := [][]string{}
+	for _, h := range opponents {
+		data = append(data, h.Data())
+	}
+	b := bytes.NewBuffer([]byte{})
+	RenderTable(b, r.Player+"'s opponents with at least "+fmt.Sprintf("%d", minGames)+" games",
+		[]string{"Opponent", "Games", "Score", "White", "Black", "Rating +/-", "Openings"}, data)
+	return string(b.Bytes())
+}
+
+// HeadToHeadOpenings shows how the openings played against the opponent
+// worked out.
+func (r *Report) HeadToHeadOpenings(opponent string) string {
+	h, ok := r.HeadToHeads[opponent]
+	if !ok {
+		return fmt.Sprintf("%s never played against %s", r.Player, opponent)
+	}
+	data := [][]string{}
+	for _, opening := range h.SortedOpenings() {
+		data = append(data, append([]string{opening}, h.Openings[opening].Data()...))
+	}
+	data = append(data, append([]string{"Total"}, h.Statistic.Data()...))
+	b := bytes.NewBuffer([]byte{})
+	RenderTable(b, r.Player+" against "+opponent, append([]string{"Opening"}, h.Statistic.Headers()...), data)
+	return string(b.Bytes())
+}
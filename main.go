@@ -20,9 +20,12 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"sort"
+	"strings"
+	"time"
 
 	"github.com/freeeve/pgn"
 	"github.com/olekukonko/tablewriter"
@@ -30,60 +33,158 @@ import (
 
 var Player = flag.String("player", "bartspaans", "The player's name.")
 var Order = flag.String("order", "opening", "Order rows. One of: opening, played, played-white, played-black, won, lost, drawn, won-white, won-black, lost-white, lost-black, drawn-white, drawn-black")
-
-// TODO: classify openings
-// TODO: build move tree for white
-// TODO: build move tree for black
+var BookExits = flag.Bool("book-exits", false, "Report where the games left book and who played the first non-book move.")
+var GroupBy = flag.String("group-by", "name", "Group the openings in the report. One of: name, family (A-E), eco (B90), extended (B90a), variation (B90a1)")
+var Classify = flag.String("classify", "tree", "How to classify openings. One of: tree (scid.eco), tag (the PGN's ECO/Opening tags), tree-tag (scid.eco, falling back to the tags)")
+var Mismatches = flag.Bool("mismatches", false, "List the games where the PGN's ECO, Opening or ECOUrl tags disagree with the scid.eco classification.")
+var Mode = flag.String("mode", "report", "What to output. One of: report, trends, diff, scout, prepare, head-to-head, puzzles, train, repertoire, polyglot, export, search")
+var PeriodLength = flag.String("period", "month", "The length of the periods in the trends. One of: week, month, quarter")
+var ComparePeriods = flag.String("compare-periods", "", "The two periods to compare in the trends or diff, e.g. 2019-10,2019-11. Defaults to the last two periods in the trends, and to all games in the diff.")
+var DiffPlayer = flag.String("diff-player", "", "The player to compare with in the diff. Defaults to --player.")
+var DiffFiles = flag.String("diff-files", "", "Comma separated PGN files to compare with in the diff. Defaults to the same files.")
+var OpponentPlayer = flag.String("opponent", "", "The opponent to prepare against, or to show the openings of in the head-to-head.")
+var OpponentFiles = flag.String("opponent-files", "", "Comma separated PGN files with the opponent's games. Defaults to the same files.")
+var MinGames = flag.Int("min-games", 3, "The number of games a line needs to be included in the scouting and preparation reports and the training, or the number of games against an opponent in the head-to-head.")
+var RatingBands = flag.String("rating-bands", "", "Split the openings by the rating difference with the opponent, using these boundaries, e.g. -200,-50,50,200")
+var ShowTerminations = flag.Bool("terminations", false, "Report how the games ended (checkmate, resignation, time, ...) per opening and colour.")
+var ShowClocks = flag.Bool("clocks", false, "Report the time usage per opening, based on the [%clk] comments in the games.")
+var OpeningMoves = flag.Int("opening-moves", 10, "The number of moves that make up the opening phase in the time usage report.")
+var EnginePath = flag.String("engine", "", "The path to a UCI engine. If set the report includes the average evaluation per opening.")
+var EngineDepth = flag.Int("engine-depth", 12, "The depth the engine searches each position to. 0 for no limit.")
+var EngineNodes = flag.Int("engine-nodes", 0, "The number of nodes the engine searches in each position. 0 for no limit.")
+var EngineMoveTime = flag.Int("engine-movetime", 0, "The number of milliseconds the engine searches each position. 0 for no limit.")
+var EngineCache = flag.String("engine-cache", "evaluations.json", "The file the engine evaluations are cached in. Empty to disable the cache.")
+var EvalPly = flag.Int("eval-ply", 30, "The ply after which the games are evaluated by the engine, next to the book exit.")
+var ShowMistakes = flag.Bool("mistakes", false, "Report the positions where the player lost the most centipawns, based on the [%eval] comments in the games or the --engine.")
+var MistakeMoves = flag.Int("mistake-moves", 15, "The number of moves to look for mistakes and puzzles in.")
+var PuzzleFormat = flag.String("puzzle-format", "pgn", "The format of the puzzles. One of: pgn, csv (the lichess puzzle database format)")
+var PuzzleSwing = flag.Int("puzzle-swing", 200, "The number of centipawns a mistake needs to lose to become a puzzle.")
+var PuzzleOpenings = flag.String("puzzle-openings", "", "Comma separated parts of opening names to make puzzles for, e.g. Sicilian,Italian. Defaults to all openings.")
+var TrainColour = flag.String("train-colour", "white", "The repertoire to train. One of: white, black")
+var TrainLines = flag.Int("train-lines", 10, "The number of lines to play in a training session.")
+var TrainFile = flag.String("train-file", "training.json", "The file the training progress is kept in.")
+var WhiteRepertoire = flag.String("white-repertoire", "", "A PGN file with the player's prepared white lines, as variations or separate games.")
+var BlackRepertoire = flag.String("black-repertoire", "", "A PGN file with the player's prepared black lines, as variations or separate games.")
+var PolyglotFile = flag.String("polyglot-file", "book.bin", "The file to write the Polyglot book to.")
+var PolyglotSource = flag.String("polyglot-source", "player", "The moves in the Polyglot book. One of: player (the player's white and black trees), eco (the scid.eco classification)")
+var PolyglotSides = flag.String("polyglot-sides", "ours", "Which moves of the player's games go in the Polyglot book. One of: ours, both")
+var OpeningsFiles = flag.String("openings", "scid.eco", "Comma separated files with the opening classification, e.g. a.tsv,b.tsv,c.tsv,d.tsv,e.tsv from lichess' chess-openings.")
+var OpeningsFormat = flag.String("openings-format", "", "The format of the --openings files. One of: scid, lichess (TSV), epd. Defaults to the format matching the extension (.eco, .tsv, .epd).")
+var ExportFile = flag.String("export-file", "games.csv", "The file to export the games to.")
+var ExportFileFormat = flag.String("export-format", "", "The format of the --export-file. One of: csv, sqlite. Defaults to the format matching the extension (.csv, .db, .sqlite).")
+var SearchPosition = flag.String("position", "", "The position to search for with --mode search, as a FEN or as moves from the starting position, e.g. \"1. e4 c5 2. Nf3\".")
+var FilterExpression = flag.String("filter", "", "Only count the games matching this filter, e.g. 'color = white and tc = blitz and opp_elo > 1800'. See the README for the fields and operators.")
+var FilterFile = flag.String("filter-file", "", "A file with a filter expression. Combined with --filter if both are given.")
+var StorePath = flag.String("store", "", "A SQLite file to keep the games in. The files given as arguments are imported into it first, skipping the games that are already stored, and the reports are generated from all the stored games.")
+var Depth = flag.Int("depth", 16, "The number of plies to add to the white and black move trees.")
 
 type Report struct {
+	Player       string
 	Openings     map[string][]*pgn.Game
 	OpeningStats map[string]*Statistic
+	BookExits    map[string]*BookExitStatistic
+	Mismatches   []*ClassificationMismatch
+	HeadToHeads  map[string]*HeadToHead
+	Clocks       map[string]*ClockStatistic
+	Evaluations  map[string]*EvaluationStatistic
+	Mistakes     map[string][]*Mistake
 	Statistic    *Statistic
+	// The player's games in the order they were counted. They're only kept
+	// for the modes that need the games themselves: export and puzzles.
+	Games []*GameRecord
+
+	// The move trees of the games played with the white and black pieces.
+	White *MoveTree
+	Black *MoveTree
+
+	// The engine used to evaluate the games, or nil.
+	Engine *Engine
 }
 
-func NewReport() *Report {
+func NewReport(player string) *Report {
 	return &Report{
+		Player:       player,
 		Openings:     map[string][]*pgn.Game{},
 		OpeningStats: map[string]*Statistic{},
+		BookExits:    map[string]*BookExitStatistic{},
+		HeadToHeads:  map[string]*HeadToHead{},
+		Clocks:       map[string]*ClockStatistic{},
+		Evaluations:  map[string]*EvaluationStatistic{},
+		Mistakes:     map[string][]*Mistake{},
 		Statistic:    NewStatistic(),
+		White:        NewMoveTree("", "Start position"),
+		Black:        NewMoveTree("", "Start position"),
 	}
 }
 
-func (r *Report) Count(openingTree *MoveTree, game *pgn.Game) {
+func (r *Report) Count(classifier Classifier, game *Game, classification *Classification) error {
 
-	if game.Tags["White"] != *Player && game.Tags["Black"] != *Player {
-		fmt.Printf("Skipping game, because player '%s' wasn't playing (NB. you can set the player username with --player)\n", *Player)
-		return
+	if game.Tags["White"] != r.Player && game.Tags["Black"] != r.Player {
+		fmt.Fprintf(os.Stderr, "Skipping game, because player '%s' wasn't playing (NB. you can set the player username with --player)\n", r.Player)
+		return nil
 	}
 
-	playingWithWhitePieces := game.Tags["White"] == *Player
+	playingWithWhitePieces := game.Tags["White"] == r.Player
 	gameResult := game.Tags["Result"]
 	r.Statistic.Count(playingWithWhitePieces, gameResult)
+	r.Statistic.CountOpponent(playingWithWhitePieces, gameResult, OpponentElo(game.Game, r.Player))
 
-	opening := openingTree.ClassifyGame(game)
-	openingFound := opening != ""
-	if openingFound {
-		r.CountOpening(playingWithWhitePieces, gameResult, opening, game)
+	classification.CountGame(game.Game)
+	opening := ReportOpening(classification, game.Game)
+	record := &GameRecord{Game: game, White: playingWithWhitePieces, Opening: opening, Classification: classification}
+	if *Mode == "export" || *Mode == "puzzles" {
+		r.Games = append(r.Games, record)
+	}
+	r.CountOpening(playingWithWhitePieces, gameResult, opening, game.Game)
+	if classification.CustomStart && classification.Start == nil {
+		return nil
+	}
+
+	if playingWithWhitePieces {
+		r.White.AddGame(game.Game, classifier.Tree(), *Depth)
+	} else {
+		r.Black.AddGame(game.Game, classifier.Tree(), *Depth)
 	}
-	/*
-		if game.Tags["ECO"] != "" {
-			r.CountOpening(playingWithWhitePieces, gameResult, game.Tags["ECO"], game)
-			openingFound = true
-		}
-	*/
-	if !openingFound {
-		r.CountOpening(playingWithWhitePieces, gameResult, "Unknown opening", game)
 
-		fmt.Println("Unknown opening: ")
+	if IsClassificationMismatch(classification, game.Game) {
+		r.Mismatches = append(r.Mismatches, &ClassificationMismatch{game.Game, classification})
+	}
+	if opening != "Unknown opening" {
+		if _, ok := r.BookExits[opening]; !ok {
+			r.BookExits[opening] = NewBookExitStatistic()
+		}
+		r.BookExits[opening].Count(playingWithWhitePieces, classification)
+		usage := NewClockUsage(game, playingWithWhitePieces, *OpeningMoves, classification.BookPlies)
+		record.Clock = usage
+		if usage != nil {
+			if _, ok := r.Clocks[opening]; !ok {
+				r.Clocks[opening] = NewClockStatistic()
+			}
+			r.Clocks[opening].Count(usage)
+		}
+		if r.Engine != nil {
+			if err := r.CountEvaluations(opening, playingWithWhitePieces, game.Game, classification, *EvalPly); err != nil {
+				return err
+			}
+		}
+		if *ShowMistakes {
+			if err := r.CountMistakes(opening, playingWithWhitePieces, game, classification, *MistakeMoves); err != nil {
+				return err
+			}
+		}
+	}
+	if opening == "Unknown opening" {
+		fmt.Fprintln(os.Stderr, "Unknown opening: ")
 		b := pgn.NewBoard()
 		for _, move := range game.Moves {
 			// make the move on the board
-			fmt.Println(move)
+			fmt.Fprintln(os.Stderr, move)
 			b.MakeMove(move)
 			// print out FEN for each move in the game
-			fmt.Println(b)
+			fmt.Fprintln(os.Stderr, b)
 		}
 	}
+	return nil
 }
 
 func (r *Report) CountOpening(white bool, gameResult, opening string, game *pgn.Game) {
@@ -93,12 +194,19 @@ func (r *Report) CountOpening(white bool, gameResult, opening string, game *pgn.
 	}
 	r.Openings[opening] = append(r.Openings[opening], game)
 	r.OpeningStats[opening].Count(white, gameResult)
+	r.OpeningStats[opening].CountOpponent(white, gameResult, OpponentElo(game, r.Player))
+
+	opponent := Opponent(game, r.Player)
+	if _, ok := r.HeadToHeads[opponent]; !ok {
+		r.HeadToHeads[opponent] = NewHeadToHead(opponent)
+	}
+	r.HeadToHeads[opponent].Count(white, gameResult, opening, game, r.Player)
 }
 
 func (r *Report) String() string {
 	data := [][]string{}
 	for opening, stats := range r.OpeningStats {
-		row := append([]string{LookupECO(opening)}, stats.Data()...)
+		row := append([]string{opening}, stats.Data()...)
 		data = append(data, row)
 
 	}
@@ -163,6 +271,18 @@ func (r *Report) String() string {
 	return string(b.Bytes())
 }
 
+// RenderTable writes a title followed by a table.
+func RenderTable(w io.Writer, title string, header []string, data [][]string) {
+	fmt.Fprintln(w, title)
+	table := tablewriter.NewWriter(w)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeader(header)
+	table.AppendBulk(data)
+	table.SetRowLine(true)
+	table.Render()
+	fmt.Fprintln(w)
+}
+
 var Openings = map[string]string{
 	"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR":          "King's Pawn Opening",
 	"rnbqkbnr/pppp1ppp/8/4p3/4P3/8/PPPP1PPP/RNBQKBNR":        "King's Pawn game",
@@ -184,35 +304,321 @@ var Openings = map[string]string{
 	"rnbqkbnr/pppppppp/8/8/3P4/8/PPP1PPPP/RNBQKBNR":          "Queen's Pawn Opening",
 }
 
+// ReadPGNFiles scans all the games in the given files.
+func ReadPGNFiles(paths []string, count func(game *Game)) error {
+	for _, arg := range paths {
+		fmt.Fprintln(os.Stderr, "Processing", arg)
+		if err := ReadPGNFile(arg, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GameSource calls count for every game in a collection of games.
+type GameSource func(count func(game *Game)) error
+
+// PGNFiles returns the games in the given files as a GameSource.
+func PGNFiles(paths []string) GameSource {
+	return func(count func(game *Game)) error {
+		return ReadPGNFiles(paths, count)
+	}
+}
+
+// ReadReport counts the player's games in the source. If a period is given
+// only the games played in that period are counted. The filter and engine
+// are optional. The games after the first one that can't be counted are
+// skipped.
+func ReadReport(classifier Classifier, player string, source GameSource, period string, filter *Filter, engine *Engine) (*Report, error) {
+	report := NewReport(player)
+	report.Engine = engine
+	var countErr error
+	err := source(func(game *Game) {
+		if countErr != nil {
+			return
+		}
+		if period != "" && Period(game.Game, *PeriodLength) != period {
+			return
+		}
+		classification := GameClassification(classifier, game)
+		if filter.Match(game.Game, player, classification) {
+			countErr = report.Count(classifier, game, classification)
+		}
+	})
+	if err == nil {
+		err = countErr
+	}
+	return report, err
+}
+
 func main() {
 	flag.Parse()
 
-	openingTree, err := ParseECOClassificationIntoTree()
+	var bands []int
+	if *RatingBands != "" {
+		var err error
+		bands, err = ParseRatingBands(*RatingBands)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	classifier, classifierHash, err := ReadClassifier(strings.Split(*OpeningsFiles, ","), *OpeningsFormat)
 	if err != nil {
-		panic(err)
+		log.Fatal(err)
 	}
 
-	report := NewReport()
-	for _, arg := range flag.Args() {
-		fmt.Println("Processing", arg)
-		f, err := os.Open(arg)
+	var filter *Filter
+	if *FilterFile != "" {
+		filter, err = ReadFilter(*FilterFile)
 		if err != nil {
 			log.Fatal(err)
 		}
-		ps := pgn.NewPGNScanner(f)
-		// while there's more to read in the file
-		for ps.Next() {
-			// scan the next game
-			game, err := ps.Scan()
-			if err != nil {
+	}
+	if *FilterExpression != "" {
+		expression, err := ParseFilter(*FilterExpression)
+		if err != nil {
+			log.Fatal(err)
+		}
+		filter = filter.And(expression)
+	}
+
+	exportFormat := *ExportFileFormat
+	if exportFormat == "" {
+		exportFormat = ExportFormat(*ExportFile)
+	}
+	if *Mode == "export" {
+		if exportFormat != "csv" && exportFormat != "sqlite" {
+			log.Fatalf("Unknown export format '%s'. One of: csv, sqlite", exportFormat)
+		}
+		if *StorePath != "" && SameFile(*ExportFile, *StorePath) {
+			log.Fatal("The export can't be written to the --store file")
+		}
+	}
+	if *Mode == "puzzles" {
+		if *PuzzleFormat != "pgn" && *PuzzleFormat != "csv" {
+			log.Fatalf("Unknown puzzle format '%s'. One of: pgn, csv", *PuzzleFormat)
+		}
+	}
+
+	var engine *Engine
+	if *EnginePath != "" {
+		limits := EngineLimits{Depth: *EngineDepth, Nodes: *EngineNodes, MoveTime: *EngineMoveTime}
+		engine, err = NewEngine(*EnginePath, limits, *EngineCache)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() {
+			if err := engine.Close(); err != nil {
 				log.Fatal(err)
 			}
-			report.Count(openingTree, game)
+		}()
+	}
+	// fatal stops the engine before exiting, as log.Fatal skips the deferred
+	// Close that writes the evaluation cache.
+	fatal := func(v ...interface{}) {
+		if engine != nil {
+			engine.Close()
+		}
+		log.Fatal(v...)
+	}
+
+	games := PGNFiles(flag.Args())
+	if *StorePath != "" {
+		store, err := OpenGameStore(*StorePath)
+		if err != nil {
+			fatal(err)
+		}
+		defer store.Close()
+		added, stored, err := store.Import(flag.Args())
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "Imported %d new game(s), %d already stored\n", added, stored)
+		games = store.ClassifiedGames(classifier, classifierHash)
+	}
+
+	periods := strings.Split(*ComparePeriods+",", ",")
+	otherFiles := func(files string) GameSource {
+		if files == "" {
+			return games
+		}
+		return PGNFiles(strings.Split(files, ","))
+	}
+	switch *Mode {
+	case "diff":
+		otherPlayer := *Player
+		if *DiffPlayer != "" {
+			otherPlayer = *DiffPlayer
+		}
+		left, err := ReadReport(classifier, *Player, games, periods[0], filter, nil)
+		if err != nil {
+			fatal(err)
+		}
+		right, err := ReadReport(classifier, otherPlayer, otherFiles(*DiffFiles), periods[1], filter, nil)
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(NewReportDiff(left, periods[0], right, periods[1]))
+		return
+	case "search":
+		if *SearchPosition == "" {
+			log.Fatal("--mode search needs the --position to search for")
+		}
+		position, err := ParsePosition(*SearchPosition)
+		if err != nil {
+			fatal(err)
+		}
+		index := PositionIndex{}
+		err = games(func(game *Game) {
+			if filter == nil || filter.Match(game.Game, *Player, GameClassification(classifier, game)) {
+				index.Add(game.Game)
+			}
+		})
+		if err != nil {
+			fatal(err)
+		}
+		fmt.Println(index.Search(position))
+		return
+	case "prepare":
+		if *OpponentPlayer == "" {
+			fatal("--mode prepare needs the --opponent to prepare against")
+		}
+		mine, err := ReadReport(classifier, *Player, games, "", filter, nil)
+		if err != nil {
+			fatal(err)
+		}
+		theirs, err := ReadReport(classifier, *OpponentPlayer, otherFiles(*OpponentFiles), "", filter, nil)
+		if err != nil {
+			fatal(err)
 		}
+		fmt.Println(NewPreparation(mine, theirs, *MinGames))
+		return
 	}
-	fmt.Println(report)
-	fmt.Println(report.Statistic.Header())
-	fmt.Println(report.Statistic)
 
-	fmt.Println(openingTree.PruneGameLessBranches())
+	report, err := ReadReport(classifier, *Player, games, "", filter, engine)
+	if err != nil {
+		fatal(err)
+	}
+	switch *Mode {
+	case "trends":
+		fmt.Println(NewTrend(report, *PeriodLength).String(periods[0], periods[1]))
+	case "scout":
+		fmt.Println(NewScoutingReport(report, *MinGames, *PeriodLength))
+	case "head-to-head":
+		if *OpponentPlayer != "" {
+			fmt.Println(report.HeadToHeadOpenings(*OpponentPlayer))
+		} else {
+			fmt.Println(report.HeadToHeadReport(*MinGames))
+		}
+	case "repertoire":
+		readRepertoire := func(path string) *MoveTree {
+			if path == "" {
+				return nil
+			}
+			tree, err := ReadRepertoire(path)
+			if err != nil {
+				fatal(err)
+			}
+			return tree
+		}
+		fmt.Println(NewRepertoireReport(report, readRepertoire(*WhiteRepertoire), readRepertoire(*BlackRepertoire)))
+	case "polyglot":
+		book := PolyglotBook{}
+		if *PolyglotSource == "eco" {
+			book.AddBook(classifier.Tree())
+		} else {
+			book.AddTree(report.White, report.Player, true, *PolyglotSides)
+			book.AddTree(report.Black, report.Player, false, *PolyglotSides)
+		}
+		f, err := os.Create(*PolyglotFile)
+		if err != nil {
+			fatal(err)
+		}
+		if err := book.Write(f); err != nil {
+			fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("Wrote %d positions to %s\n", len(book), *PolyglotFile)
+	case "export":
+		switch exportFormat {
+		case "csv":
+			f, err := os.Create(*ExportFile)
+			if err != nil {
+				fatal(err)
+			}
+			if err := WriteGamesCSV(f, report.Player, report.Games); err != nil {
+				fatal(err)
+			}
+			if err := f.Close(); err != nil {
+				fatal(err)
+			}
+		case "sqlite":
+			if err := WriteGamesSQLite(*ExportFile, report.Player, report.Games); err != nil {
+				fatal(err)
+			}
+		}
+		fmt.Printf("Wrote %d games to %s\n", len(report.Games), *ExportFile)
+	case "train":
+		progress, err := LoadTrainingProgress(*TrainFile)
+		if err != nil {
+			fatal(err)
+		}
+		trainer := NewTrainer(*Player, progress, *MinGames, os.Stdin, os.Stdout)
+		white := *TrainColour != "black"
+		tree := report.White
+		if !white {
+			tree = report.Black
+		}
+		if err := trainer.Train(tree, white, *TrainLines); err != nil {
+			fatal(err)
+		}
+		fmt.Printf("%d of %d correct, %d position(s) due\n", trainer.Correct, trainer.Asked, progress.Due(*Player, time.Now()))
+	case "puzzles":
+		filters := []string{}
+		if *PuzzleOpenings != "" {
+			filters = strings.Split(*PuzzleOpenings, ",")
+		}
+		puzzles, err := report.Puzzles(*MistakeMoves, *PuzzleSwing, filters)
+		if err != nil {
+			fatal(err)
+		}
+		if *PuzzleFormat == "csv" {
+			fmt.Print(PuzzlesCSV(puzzles))
+		} else {
+			fmt.Print(PuzzlesPGN(puzzles))
+		}
+	default:
+		fmt.Println(report)
+		fmt.Println(report.Statistic.Header())
+		fmt.Println(report.Statistic)
+		if *BookExits {
+			fmt.Println(report.BookExitReport())
+		}
+		if *Mismatches {
+			fmt.Println(report.MismatchReport())
+		}
+		if bands != nil {
+			fmt.Println(report.RatingBandReport(bands))
+		}
+		if *ShowTerminations {
+			fmt.Println(report.TerminationReport())
+		}
+		if *ShowClocks {
+			fmt.Println(report.ClockReport(*OpeningMoves))
+		}
+		if engine != nil {
+			fmt.Println(report.EvaluationReport(*EvalPly))
+		}
+		if *ShowMistakes {
+			fmt.Println(report.MistakeReport(5))
+		}
+
+		fmt.Println("White:")
+		fmt.Println(report.White)
+		fmt.Println("Black:")
+		fmt.Println(report.Black)
+	}
 }
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// The centipawns a move needs to lose to count as a mistake or a blunder.
+const (
+	MistakeLoss = 100
+	BlunderLoss = 300
+)
+
+// StartEvaluation is the evaluation of the standard starting position.
+var StartEvaluation = &Evaluation{}
+
+var evalRegexp = regexp.MustCompile(`\[%eval\s+(#)?([-+]?\d+(?:\.\d+)?)[^\]]*\]`)
+
+// ParseEval returns the evaluation in a comment like "[%eval 0.25]" or
+// "[%eval #-3]", as added to lichess exports. These are from white's
+// perspective, in pawns.
+func ParseEval(comment string) (*Evaluation, bool) {
+	match := evalRegexp.FindStringSubmatch(comment)
+	if match == nil {
+		return nil, false
+	}
+	if match[1] == "#" {
+		mate, err := strconv.Atoi(strings.TrimPrefix(match[2], "+"))
+		if err != nil {
+			return nil, false
+		}
+		return &Evaluation{Mate: mate}, true
+	}
+	pawns, err := strconv.ParseFloat(match[2], 64)
+	if err != nil {
+		return nil, false
+	}
+	if pawns < 0 {
+		return &Evaluation{Centipawns: int(pawns*100 - 0.5)}, true
+	}
+	return &Evaluation{Centipawns: int(pawns*100 + 0.5)}, true
+}
+
+// GameEvaluations returns the evaluations of the positions in the first
+// plies of the game, where the element at index i is the position after i
+// plies. The [%eval] comments are used if the game has them, otherwise the
+// engine if it's not nil. The comments only follow the moves, so the
+// starting position is evaluated by the engine, or as StartEvaluation if
+// there is none and the game starts from the standard position. Positions
+// without an evaluation are nil and nil is returned if there are none at
+// all.
+func GameEvaluations(game *Game, engine *Engine, plies int) ([]*Evaluation, error) {
+	if plies > len(game.Moves) {
+		plies = len(game.Moves)
+	}
+	b, ok := GameBoard(game.Game, 0)
+	if !ok {
+		return nil, nil
+	}
+	evaluations := make([]*Evaluation, plies+1)
+	found := false
+	comments := game.Comments
+	for ply := 0; ply < plies && ply < len(comments); ply++ {
+		if evaluation, ok := ParseEval(comments[ply]); ok {
+			evaluations[ply+1] = evaluation
+			found = true
+		}
+	}
+	if found {
+		if engine != nil {
+			evaluation, err := engine.Evaluate(b.String())
+			if err != nil {
+				return nil, err
+			}
+			evaluations[0] = evaluation
+		} else if game.Tags["FEN"] == "" {
+			evaluations[0] = StartEvaluation
+		}
+		return evaluations, nil
+	}
+	if engine == nil {
+		return nil, nil
+	}
+	for ply := range evaluations {
+		if ply > 0 {
+			b.MakeMove(game.Moves[ply-1])
+		}
+		evaluation, err := engine.Evaluate(b.String())
+		if err != nil {
+			return nil, err
+		}
+		evaluations[ply] = evaluation
+	}
+	return evaluations, nil
+}
+
+// Mistake is a move by the player that lost at least MistakeLoss centipawns.
+type Mistake struct {
+	Game *pgn.Game
+	// Ply is the number of plies played before the mistake.
+	Ply int
+	// FEN is the position before the mistake.
+	FEN string
+	// Move is the move that was played, in coordinate notation.
+	Move string
+	// Loss is the number of centipawns the move lost, with evaluations
+	// capped at MaxAverageScore.
+	Loss int
+	// Before is the evaluation of the position before the mistake. Its best
+	// move is only known when it came from an engine.
+	Before *Evaluation
+	// Node is the position before the mistake in the player's move tree,
+	// or nil if the mistake was made past the depth of the tree.
+	Node *MoveTree
+}
+
+func (m *Mistake) Blunder() bool {
+	return m.Loss >= BlunderLoss
+}
+
+// FindMistakes returns the player's moves that lost at least MistakeLoss
+// centipawns, according to the evaluations of GameEvaluations.
+func FindMistakes(game *pgn.Game, white bool, evaluations []*Evaluation) []*Mistake {
+	mistakes := []*Mistake{}
+	b, ok := GameBoard(game, 0)
+	if !ok {
+		return mistakes
+	}
+	for ply := 0; ply+1 < len(evaluations) && ply < len(game.Moves); ply++ {
+		if ply > 0 {
+			b.MakeMove(game.Moves[ply-1])
+		}
+		before, after := evaluations[ply], evaluations[ply+1]
+		if before == nil || after == nil || (strings.Fields(b.String())[1] == "w") != white {
+			continue
+		}
+		loss := capScore(before.Score(white)) - capScore(after.Score(white))
+		if loss < MistakeLoss {
+			continue
+		}
+		mistakes = append(mistakes, &Mistake{
+			Game:   game,
+			Ply:    ply,
+			FEN:    b.String(),
+			Move:   Coord(game.Moves[ply]),
+			Loss:   loss,
+			Before: before,
+		})
+	}
+	return mistakes
+}
+
+// CountMistakes looks for mistakes in the player's first moves of the game
+// and attributes them to the nodes in the player's move tree.
+func (r *Report) CountMistakes(opening string, white bool, game *Game, classification *Classification, moves int) error {
+	evaluations, err := GameEvaluations(game, r.Engine, 2*moves)
+	if err != nil || evaluations == nil {
+		return err
+	}
+	tree := r.White
+	if !white {
+		tree = r.Black
+	}
+	if classification.CustomStart {
+		tree = tree.Follow(classification.Start.Line())
+	}
+	for _, mistake := range FindMistakes(game.Game, white, evaluations) {
+		if mistake.Before.BestMove == "" && r.Engine != nil {
+			before, err := r.Engine.Evaluate(mistake.FEN)
+			if err != nil {
+				return err
+			}
+			mistake.Before = before
+		}
+		if tree != nil {
+			moves := []string{}
+			for _, move := range game.Moves[:mistake.Ply] {
+				moves = append(moves, Coord(move))
+			}
+			mistake.Node = tree.Follow(moves)
+		}
+		if mistake.Node != nil {
+			mistake.Node.Mistakes = append(mistake.Node.Mistakes, mistake)
+		}
+		r.Mistakes[opening] = append(r.Mistakes[opening], mistake)
+	}
+	return nil
+}
+
+// MistakeReport lists per opening the positions where the player most often
+// went wrong, with the move that was played most and the engine's move if
+// it's known.
+func (r *Report) MistakeReport(positions int) string {
+	type position struct {
+		mistakes []*Mistake
+		blunders int
+		loss     int
+	}
+	openings := []string{}
+	for opening := range r.Mistakes {
+		openings = append(openings, opening)
+	}
+	sort.Slice(openings, func(i, j int) bool {
+		if len(r.Mistakes[openings[i]]) != len(r.Mistakes[openings[j]]) {
+			return len(r.Mistakes[openings[i]]) > len(r.Mistakes[openings[j]])
+		}
+		return openings[i] < openings[j]
+	})
+	data := [][]string{}
+	for _, opening := range openings {
+		byPosition := map[string]*position{}
+		keys := []string{}
+		for _, mistake := range r.Mistakes[opening] {
+			b, _ := pgn.NewBoardFEN(mistake.FEN)
+			key := PositionKey(b)
+			if _, ok := byPosition[key]; !ok {
+				byPosition[key] = &position{}
+				keys = append(keys, key)
+			}
+			p := byPosition[key]
+			p.mistakes = append(p.mistakes, mistake)
+			p.loss += mistake.Loss
+			if mistake.Blunder() {
+				p.blunders++
+			}
+		}
+		sort.SliceStable(keys, func(i, j int) bool {
+			return len(byPosition[keys[i]].mistakes) > len(byPosition[keys[j]].mistakes)
+		})
+		if len(keys) > positions {
+			keys = keys[:positions]
+		}
+		for _, key := range keys {
+			p := byPosition[key]
+			played := map[string]int{}
+			mostPlayed := p.mistakes[0]
+			betterMove := ""
+			for _, mistake := range p.mistakes {
+				played[mistake.Move]++
+				if played[mistake.Move] > played[mostPlayed.Move] {
+					mostPlayed = mistake
+				}
+				if betterMove == "" {
+					betterMove = mistake.Before.BestMove
+				}
+			}
+			b, _ := pgn.NewBoardFEN(mostPlayed.FEN)
+			data = append(data, []string{
+				opening,
+				mistakeLine(mostPlayed),
+				moveSAN(b, mostPlayed.Move),
+				fmt.Sprintf("%d", len(p.mistakes)),
+				fmt.Sprintf("%d", p.blunders),
+				fmt.Sprintf("%.2f", float64(p.loss)/float64(len(p.mistakes))/100),
+				moveSAN(b, betterMove),
+			})
+		}
+	}
+	b := bytes.NewBuffer([]byte{})
+	RenderTable(b, "Where "+r.Player+" went wrong in the opening",
+		[]string{"Opening", "Position", "Played", "Mistakes", "Blunders", "Average loss", "Better"}, data)
+	return string(b.Bytes())
+}
+
+// mistakeLine returns the moves leading up to the mistake, or the FEN of
+// the position if the game didn't start from the standard position.
+func mistakeLine(mistake *Mistake) string {
+	if IsCustomStart(mistake.Game) {
+		return mistake.FEN
+	}
+	moves := []string{}
+	for _, move := range mistake.Game.Moves[:mistake.Ply] {
+		moves = append(moves, Coord(move))
+	}
+	if len(moves) == 0 {
+		return "Start position"
+	}
+	return FormatLine(moves)
+}
+
+func moveSAN(b *pgn.Board, coord string) string {
+	move, err := pgn.MoveFromCoord(coord)
+	if err != nil {
+		return coord
+	}
+	return SAN(b, move)
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestFindMistakesFirstMove(t *testing.T) {
+	games, err := ParsePGN(`[White "alice"]
+[Black "bob"]
+[Result "0-1"]
+
+1. f3 { [%eval -1.5] } 1... e5 { [%eval -1.4] } 2. g4 { [%eval #-1] } 2... Qh4# 0-1`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	evaluations, err := GameEvaluations(games[0], nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(evaluations) != 5 || evaluations[0] != StartEvaluation {
+		t.Fatalf("Expected the start position to be evaluated, got %v", evaluations)
+	}
+	mistakes := FindMistakes(games[0].Game, true, evaluations)
+	if len(mistakes) != 2 {
+		t.Fatalf("Expected 2 mistakes, got %d", len(mistakes))
+	}
+	for i, expected := range []struct {
+		ply  int
+		move string
+		loss int
+	}{
+		{0, "f2f3", 150},
+		{2, "g2g4", MaxAverageScore - 140},
+	} {
+		mistake := mistakes[i]
+		if mistake.Ply != expected.ply || mistake.Move != expected.move || mistake.Loss != expected.loss {
+			t.Errorf("Expected %+v, got ply %d, %s, loss %d", expected, mistake.Ply, mistake.Move, mistake.Loss)
+		}
+	}
+	if mistakes[1].FEN != "rnbqkbnr/pppp1ppp/8/4p3/8/5P2/PPPPP1PP/RNBQKBNR w KQkq e6 0 2" {
+		t.Errorf("Unexpected position before the mistake %s", mistakes[1].FEN)
+	}
+}
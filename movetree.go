@@ -1,9 +1,8 @@
 package main
 
 import (
-	"bytes"
 	"fmt"
-	"io/ioutil"
+	"sort"
 	"strings"
 
 	"github.com/freeeve/pgn"
@@ -15,6 +14,21 @@ type MoveTree struct {
 	Replies    map[string]*MoveTree
 	Parent     *MoveTree
 	Games      []*pgn.Game
+
+	// ECO is the extended scid code of an annotated node (e.g. B90a1).
+	ECO string
+
+	// positions indexes the nodes of the tree by position, see
+	// StartPosition.
+	positions map[string]*MoveTree
+
+	// Book is set on the nodes that are part of the opening
+	// classification, also when they are copied into a repertoire tree.
+	Book bool
+
+	// Mistakes are the mistakes the player made in this position, see
+	// Report.CountMistakes.
+	Mistakes []*Mistake
 }
 
 func NewMoveTree(move, annotation string) *MoveTree {
@@ -26,37 +40,343 @@ func NewMoveTree(move, annotation string) *MoveTree {
 	}
 }
 
+// Classification describes where a game was placed in the opening tree.
+type Classification struct {
+	// Opening is the annotation of the last named book position.
+	Opening string
+	// ECO is the extended scid code of the last named book position.
+	ECO string
+	// Node is the last book position that was reached.
+	Node *MoveTree
+	// BookPlies is the number of plies that were played in book.
+	BookPlies int
+	// Deviation is the first move that was not in book, in coordinate
+	// notation, or the empty string if the game never left book.
+	Deviation string
+	// Start is the book position the game started from, which is only
+	// different from the root for games with a FEN tag, or nil if that
+	// position is not in the tree.
+	Start *MoveTree
+	// CustomStart is set for games that didn't start from the standard
+	// starting position.
+	CustomStart bool
+
+	// tree is the classifier's tree the line of the game is added to when
+	// it's counted, if the classification was made on a line of its own,
+	// see EPDClassifier.Classify and GameStore.ClassifiedGames.
+	tree *MoveTree
+}
+
+// CountGame adds the game to the book positions it reached after its start.
+func (c *Classification) CountGame(game *pgn.Game) {
+	if c.tree != nil {
+		c.addLine()
+	}
+	for node := c.Node; node != nil && node != c.Start; node = node.Parent {
+		node.Games = append(node.Games, game)
+	}
+}
+
+// addLine adds the line from Start to Node to the classifier's tree, and
+// points the classification at the nodes in the tree.
+func (c *Classification) addLine() {
+	line := []*MoveTree{}
+	for node := c.Node; node != c.Start; node = node.Parent {
+		line = append([]*MoveTree{node}, line...)
+	}
+	tree := c.tree
+	for _, node := range line {
+		if _, ok := tree.Replies[node.Move]; !ok {
+			// the positions of games with a FEN tag are looked up again
+			c.tree.positions = nil
+		}
+		tree = tree.GetOrInsertMove(node.Move)
+		tree.Book = true
+		if node.Annotation != "" && tree.Annotation == "" {
+			tree.Annotation = node.Annotation
+			tree.ECO = node.ECO
+		}
+	}
+	c.Start = c.tree
+	c.Node = tree
+	c.tree = nil
+}
+
+// Found returns whether the game reached a named book position.
+func (c *Classification) Found() bool {
+	return c.ECO != ""
+}
+
+// LeftBook returns whether the game was continued after the last book move.
+func (c *Classification) LeftBook() bool {
+	return c.Deviation != ""
+}
+
+// DeviatedByWhite returns whether the first non-book move was played by
+// white.
+func (c *Classification) DeviatedByWhite() bool {
+	return (len(c.Start.Line())+c.BookPlies)%2 == 0
+}
+
 func (m *MoveTree) ClassifyGame(game *pgn.Game) string {
-	b := pgn.NewBoard()
-	tree := m
-	fmt.Println("Classifying new game")
-	for _, move := range game.Moves {
-		fmt.Println(move)
-		// make the move on the board
-		b.MakeMove(move)
+	return m.Classify(game).Opening
+}
 
-		next, found := tree.Replies[move.String()]
-		if found {
-			fmt.Println("Book move", next.Annotation)
-			tree = next
-			tree.Games = append(tree.Games, game)
-		} else {
+// Classify follows the game through the tree for as long as it stays in
+// book and records where it left. The tree is not changed, see
+// Classification.CountGame.
+//
+// Games that start from a custom position are classified from the book
+// position matching their FEN tag. If there is no such position the game is
+// left unclassified.
+func (m *MoveTree) Classify(game *pgn.Game) *Classification {
+	result := &Classification{
+		Start:       m.StartPosition(game),
+		CustomStart: IsCustomStart(game),
+	}
+	if result.Start == nil {
+		return result
+	}
+	tree := result.Start
+	for _, move := range game.Moves {
+		next, found := tree.Replies[Coord(move)]
+		if !found {
+			result.Deviation = Coord(move)
 			break
 		}
+		tree = next
+		result.BookPlies++
 	}
+	result.Node = tree
 	annotation := tree.Annotation
 	for annotation == "" {
 		tree = tree.Parent
 		annotation = tree.Annotation
 	}
-	return annotation
+	result.Opening = annotation
+	result.ECO = tree.ECO
+	return result
+}
+
+// IsCustomStart returns whether the game has a FEN tag with a position
+// other than the standard starting position, as used for odds games, games
+// played from a position and Chess960.
+func IsCustomStart(game *pgn.Game) bool {
+	fen, ok := game.Tags["FEN"]
+	if !ok || fen == "" {
+		return false
+	}
+	b, err := pgn.NewBoardFEN(fen)
+	if err != nil {
+		return true
+	}
+	return PositionKey(b) != PositionKey(pgn.NewBoard())
+}
+
+// StartPosition returns the node of the position the game started from.
+// This is the root of the tree, unless the game starts from a custom
+// position, in which case the position is looked up in the tree, returning
+// nil if it can't be found.
+func (m *MoveTree) StartPosition(game *pgn.Game) *MoveTree {
+	if !IsCustomStart(game) {
+		return m
+	}
+	b, err := pgn.NewBoardFEN(game.Tags["FEN"])
+	if err != nil {
+		return nil
+	}
+	if m.positions == nil {
+		m.positions = m.indexPositions()
+	}
+	return m.positions[PositionKey(b)]
+}
+
+// indexPositions maps every position in the tree to the shallowest node
+// that reaches it.
+func (m *MoveTree) indexPositions() map[string]*MoveTree {
+	type item struct {
+		tree  *MoveTree
+		board pgn.Board
+	}
+	index := map[string]*MoveTree{}
+	queue := []item{{m, *pgn.NewBoard()}}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		key := PositionKey(&current.board)
+		if _, ok := index[key]; ok {
+			continue
+		}
+		index[key] = current.tree
+		for _, tree := range current.tree.SortedReplies() {
+			move, err := pgn.MoveFromCoord(tree.Move)
+			if err != nil {
+				continue
+			}
+			b := current.board
+			b.MakeMove(move)
+			queue = append(queue, item{tree, b})
+		}
+	}
+	return index
+}
+
+// Group returns the name under which the game is reported, depending on
+// the --group-by granularity: the opening's annotation, its family (A-E),
+// ECO code (B90), extended code (B90a) or sub-variation (B90a1).
+func (c *Classification) Group(groupBy string) string {
+	if groupBy == "name" || c.ECO == "" {
+		return c.Opening
+	}
+	prefix := ECOPrefix(c.ECO, groupBy)
+	switch groupBy {
+	case "family":
+		return prefix + " " + ECOFamilies[prefix]
+	case "eco":
+		return LookupECO(prefix)
+	}
+	// Extended codes are named after the first position in the line that
+	// has the code.
+	name := ""
+	for tree := c.Node; tree != nil; tree = tree.Parent {
+		if tree.ECO != "" && ECOPrefix(tree.ECO, groupBy) == prefix {
+			name = tree.Annotation
+		}
+	}
+	return prefix + " " + name
+}
+
+// Line returns the moves leading up to this node.
+func (m *MoveTree) Line() []string {
+	result := []string{}
+	for tree := m; tree.Parent != nil; tree = tree.Parent {
+		result = append([]string{tree.Move}, result...)
+	}
+	return result
+}
+
+// Board returns the position after the moves leading up to this node.
+func (m *MoveTree) Board() *pgn.Board {
+	b := pgn.NewBoard()
+	for _, coord := range m.Line() {
+		move, err := pgn.MoveFromCoord(coord)
+		if err != nil {
+			break
+		}
+		b.MakeMove(move)
+	}
+	return b
+}
+
+// SAN returns the node's move in standard algebraic notation.
+func (m *MoveTree) SAN() string {
+	move, err := pgn.MoveFromCoord(m.Move)
+	if err != nil || m.Parent == nil {
+		return m.Move
+	}
+	return SAN(m.Parent.Board(), move)
+}
+
+// Statistic returns the results of the games that reached this node, from
+// the player's perspective.
+func (m *MoveTree) Statistic(player string) *Statistic {
+	s := NewStatistic()
+	for _, game := range m.Games {
+		white := PlaysWhite(game, player)
+		s.Count(white, game.Tags["Result"])
+		s.CountOpponent(white, game.Tags["Result"], OpponentElo(game, player))
+	}
+	return s
+}
+
+// Walk calls f for every node in the tree, in the order of SortedReplies.
+func (m *MoveTree) Walk(f func(tree *MoveTree)) {
+	f(m)
+	for _, tree := range m.SortedReplies() {
+		tree.Walk(f)
+	}
+}
+
+// BookLines returns the number of named positions in this subtree.
+func (m *MoveTree) BookLines() int {
+	result := 0
+	if m.Annotation != "" {
+		result = 1
+	}
+	for _, tree := range m.Replies {
+		result += tree.BookLines()
+	}
+	return result
+}
+
+// BookContinuations returns the replies ordered by the number of games that
+// reached them and, for replies that weren't played, by the number of book
+// lines that follow them.
+func (m *MoveTree) BookContinuations() []*MoveTree {
+	replies := m.SortedReplies()
+	sort.SliceStable(replies, func(i, j int) bool {
+		if len(replies[i].Games) != len(replies[j].Games) {
+			return len(replies[i].Games) > len(replies[j].Games)
+		}
+		return replies[i].BookLines() > replies[j].BookLines()
+	})
+	return replies
+}
+
+// AddGame adds the first depth plies of the game to the tree. Nodes that
+// can also be found in the book tree are marked as book moves and get the
+// book's annotation; moves after the game left book are still added.
+//
+// Games that start from a custom position are added after the book line
+// that leads to their position, or skipped if there is no such line.
+func (m *MoveTree) AddGame(game *pgn.Game, book *MoveTree, depth int) {
+	moves := []string{}
+	if IsCustomStart(game) {
+		if book == nil || book.StartPosition(game) == nil {
+			return
+		}
+		moves = book.StartPosition(game).Line()
+	}
+	for _, move := range game.Moves {
+		moves = append(moves, Coord(move))
+	}
+	tree := m
+	tree.Games = append(tree.Games, game)
+	for i, move := range moves {
+		if i >= depth {
+			break
+		}
+		tree = tree.GetOrInsertMove(move)
+		tree.Games = append(tree.Games, game)
+		if book != nil {
+			book = book.Replies[move]
+		}
+		if book != nil {
+			tree.Book = book.Book
+			tree.Annotation = book.Annotation
+			tree.ECO = book.ECO
+		}
+	}
+}
+
+// Follow returns the node reached by playing the moves from this node, or
+// nil if they are not all in the tree.
+func (m *MoveTree) Follow(moves []string) *MoveTree {
+	tree := m
+	for _, move := range moves {
+		next, ok := tree.Replies[move]
+		if !ok {
+			return nil
+		}
+		tree = next
+	}
+	return tree
 }
 
 func (m *MoveTree) GetOrInsertMove(move string) *MoveTree {
 	if t, ok := m.Replies[move]; ok {
 		return t
 	}
-	fmt.Println("Inserting at", move)
 	tree := NewMoveTree(move, "")
 	m.Replies[move] = tree
 	tree.Parent = m
@@ -66,6 +386,7 @@ func (m *MoveTree) GetOrInsertMove(move string) *MoveTree {
 func (m *MoveTree) PruneGameLessBranches() *MoveTree {
 	result := NewMoveTree(m.Move, m.Annotation)
 	result.Games = m.Games
+	result.Book = m.Book
 	for move, replyTree := range m.Replies {
 		if len(replyTree.Games) > 0 {
 			result.Replies[move] = replyTree.PruneGameLessBranches()
@@ -85,44 +406,58 @@ func (m *MoveTree) String() string {
 		}
 		return strings.Join(lines, "\n")
 	}
-	result := fmt.Sprintf("%s [%s] (%d)\n", m.Move, m.Annotation, len(m.Games))
-	for _, tree := range m.Replies {
+	result := fmt.Sprintf("%s (%d)\n", m.Move, len(m.Games))
+	if m.Book || m.Annotation != "" {
+		result = fmt.Sprintf("%s [%s] (%d)\n", m.Move, m.Annotation, len(m.Games))
+	}
+	for _, tree := range m.SortedReplies() {
 		result += indent(tree.String())
 	}
 	return result
 }
 
-func (m *MoveTree) AddNodeForPGN(eco, annotation, pgnStr string) {
-	f := bytes.NewReader([]byte(strings.TrimSpace(pgnStr)))
-	ps := pgn.NewPGNScanner(f)
-	for ps.Next() {
-		game, err := ps.Scan()
-		if err != nil {
-			panic(err)
-		}
-		fmt.Println(game)
-		tree := m
-		for _, move := range game.Moves {
-			tree = tree.GetOrInsertMove(move.String())
-			fmt.Println(move)
-		}
-		if tree.Annotation == "" {
-			tree.Annotation = annotation
-		} else {
-			//panic("Already annotated: " + tree.Annotation + ", " + annotation)
-		}
+// SortedReplies returns the replies ordered by the number of games that
+// reached them, most played first.
+func (m *MoveTree) SortedReplies() []*MoveTree {
+	replies := make([]*MoveTree, 0, len(m.Replies))
+	for _, tree := range m.Replies {
+		replies = append(replies, tree)
 	}
+	sort.Slice(replies, func(i, j int) bool {
+		if len(replies[i].Games) != len(replies[j].Games) {
+			return len(replies[i].Games) > len(replies[j].Games)
+		}
+		return replies[i].Move < replies[j].Move
+	})
+	return replies
 }
 
-func ParseECOClassificationIntoTree() (*MoveTree, error) {
-
-	root := NewMoveTree("", "Start position")
-	content, err := ioutil.ReadFile("scid.eco")
+// AddNodeForPGN adds the moves of an opening to the tree and annotates the
+// last one with the opening, unless it was annotated already. It returns an
+// error if one of the moves is not legal.
+func (m *MoveTree) AddNodeForPGN(eco, annotation, pgnStr string) error {
+	moves, _, err := ParseLine(pgnStr)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	tree := m
+	for _, move := range moves {
+		tree = tree.GetOrInsertMove(move)
+		tree.Book = true
+	}
+	if tree.Annotation == "" {
+		tree.Annotation = annotation
+		tree.ECO = eco
 	}
-	lines := strings.Split(string(content), "\n")
-	inDefinition := false
+	return nil
+}
+
+// AddScidECO adds the definitions in the scid .eco format to the tree.
+// Every definition starts with an extended ECO code and a quoted
+// annotation, followed by a line of moves that can continue on the next
+// (indented) lines.
+func (m *MoveTree) AddScidECO(content string) error {
+	lines := strings.Split(content, "\n")
 	eco := ""
 	annotation := ""
 	pgn := ""
@@ -130,33 +465,30 @@ func ParseECOClassificationIntoTree() (*MoveTree, error) {
 		if strings.HasPrefix(line, "#") {
 			continue
 		}
-		if line == "" {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, " ") {
+			pgn += " " + line
 			continue
 		}
-		if inDefinition && !strings.HasPrefix(line, " ") {
-			inDefinition = false
-			pgn = ""
-			root.AddNodeForPGN(eco, annotation, pgn)
-		}
-		if !inDefinition {
-			words := strings.Split(line, " ")
-			eco = words[0]
-			rest := strings.Join(words[1:], " ")
-			inDefinition = true
-
-			if strings.HasSuffix(rest, `"`) {
-				annotation = rest
-				pgn = ""
-			} else {
-				parts := strings.Split(rest, `"`)
-				annotation = parts[1]
-				pgn = parts[2]
-				root.AddNodeForPGN(eco, annotation, pgn)
+		if pgn != "" {
+			if err := m.AddNodeForPGN(eco, annotation, pgn); err != nil {
+				return fmt.Errorf("Invalid ECO definition %s: %s", eco, err.Error())
 			}
-		} else {
-			pgn += line
+		}
+		parts := strings.SplitN(line, `"`, 3)
+		if len(parts) != 3 {
+			return fmt.Errorf("Invalid ECO definition: %s", line)
+		}
+		eco = strings.TrimSpace(parts[0])
+		annotation = parts[1]
+		pgn = parts[2]
+	}
+	if pgn != "" {
+		if err := m.AddNodeForPGN(eco, annotation, pgn); err != nil {
+			return fmt.Errorf("Invalid ECO definition %s: %s", eco, err.Error())
 		}
 	}
-	root.AddNodeForPGN(eco, annotation, pgn)
-	return root, nil
+	return nil
 }
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// Game is a game read from a PGN. The pgn package skips over the comments
+// in the movetext, so they're kept next to the game.
+type Game struct {
+	*pgn.Game
+	// Comments holds the comments following each of the moves of the main
+	// line, see ParseMoveComments.
+	Comments []string
+	// Text is the PGN of the game.
+	Text string
+	// Classification is the game's classification if it was stored with
+	// the game, see GameStore.ClassifiedGames.
+	Classification *Classification
+}
+
+// PGNReader reads the games in a PGN one by one. The PGN is split into the
+// text of every game, from which the comments are read, and every text is
+// parsed on its own by pgn.PGNScanner, so the game and its text can't get
+// out of step.
+type PGNReader struct {
+	texts *gameTexts
+}
+
+// NewPGNReader returns a reader of the games in a PGN.
+func NewPGNReader(r io.Reader) *PGNReader {
+	return &PGNReader{texts: &gameTexts{r: bufio.NewReader(r)}}
+}
+
+// Next returns the next game, or io.EOF after the last game.
+func (r *PGNReader) Next() (*Game, error) {
+	text, err := r.texts.next()
+	if err != nil {
+		return nil, err
+	}
+	game, err := parseGame(text)
+	if err != nil {
+		return nil, err
+	}
+	return &Game{Game: game, Comments: ParseMoveComments(text), Text: text}, nil
+}
+
+// parseGame parses the text of a single game. The pgn package can't parse
+// variations and consecutive comments, so they are left out; the comments
+// are read from the text by ParseMoveComments.
+func parseGame(text string) (*pgn.Game, error) {
+	var result *pgn.Game
+	scanner := pgn.NewPGNScanner(strings.NewReader(withoutAnnotations(text)))
+	for scanner.Next() {
+		game, err := scanner.Scan()
+		if err != nil {
+			return nil, err
+		}
+		// the scanner returns an empty game for trailing whitespace
+		if len(game.Tags) == 0 && len(game.Moves) == 0 {
+			continue
+		}
+		if result != nil {
+			return nil, fmt.Errorf("More than one game found in '%s'", text)
+		}
+		result = game
+	}
+	if result == nil {
+		return nil, fmt.Errorf("No game found in '%s'", text)
+	}
+	return result, nil
+}
+
+// withoutAnnotations returns the text of a game without the comments and
+// variations in its movetext. Tags are kept as they are.
+func withoutAnnotations(text string) string {
+	result := []byte{}
+	depth := 0
+	inTag, inQuote, inComment, inLineComment := false, false, false, false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case inComment:
+			inComment = c != '}'
+			continue
+		case inLineComment:
+			inLineComment = c != '\n'
+			continue
+		case inTag && inQuote:
+			if c == '\\' && i+1 < len(text) {
+				result = append(result, c)
+				i++
+				c = text[i]
+			} else if c == '"' {
+				inQuote = false
+			}
+		case inTag:
+			inTag = c != ']'
+			inQuote = c == '"'
+		case c == '{':
+			inComment = true
+			continue
+		case c == ';':
+			inLineComment = true
+			continue
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+			continue
+		case c == '[' && depth == 0:
+			inTag = true
+		}
+		if depth == 0 {
+			result = append(result, c)
+		}
+	}
+	return string(result)
+}
+
+// ReadPGNFile calls count for every game in the file.
+func ReadPGNFile(path string, count func(game *Game)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	reader := NewPGNReader(f)
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("Invalid PGN '%s': %s", path, err.Error())
+		}
+		count(game)
+	}
+}
+
+// ParsePGN returns the games in the text of a PGN.
+func ParsePGN(text string) ([]*Game, error) {
+	reader := NewPGNReader(strings.NewReader(text))
+	games := []*Game{}
+	for {
+		game, err := reader.Next()
+		if err == io.EOF {
+			return games, nil
+		} else if err != nil {
+			return nil, err
+		}
+		games = append(games, game)
+	}
+}
+
+// SplitPGN calls game with the text of every game in the PGN, without
+// parsing the moves.
+func SplitPGN(r io.Reader, game func(text string) error) error {
+	texts := &gameTexts{r: bufio.NewReader(r)}
+	for {
+		text, err := texts.next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := game(text); err != nil {
+			return err
+		}
+	}
+}
+
+// gameTexts splits a PGN into the text of every game, without the
+// surrounding whitespace. Comments and
+// variations can span lines, so it keeps track of them: a game ends at the
+// result or at the first tag after the movetext, outside of comments and
+// variations.
+type gameTexts struct {
+	r *bufio.Reader
+	// pending holds the start of the next game, if it was read already.
+	pending []byte
+}
+
+func (g *gameTexts) next() (string, error) {
+	text := g.pending
+	g.pending = nil
+	word := []byte{}
+	inMoves, inTag, inQuote, inComment, inLineComment := false, false, false, false, false
+	depth := 0
+	for {
+		c, err := g.r.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return "", err
+		}
+		// the moves and results outside of comments and variations
+		if !inComment && !inLineComment && !inTag && depth == 0 && !strings.ContainsRune(" \t\r\n[]{}();", rune(c)) {
+			word = append(word, c)
+			text = append(text, c)
+			inMoves = true
+			continue
+		}
+		if isResult(string(word)) {
+			g.pending = []byte{c}
+			return strings.TrimSpace(string(text)), nil
+		}
+		word = word[:0]
+		switch {
+		case inComment:
+			inComment = c != '}'
+		case inLineComment:
+			inLineComment = c != '\n'
+		case inTag && inQuote:
+			if c == '\\' {
+				text = append(text, c)
+				if c, err = g.r.ReadByte(); err != nil {
+					return "", fmt.Errorf("Unterminated tag in '%s'", strings.TrimSpace(string(text)))
+				}
+			} else if c == '"' {
+				inQuote = false
+			}
+		case inTag:
+			inTag = c != ']'
+			inQuote = c == '"'
+		case c == '{':
+			inComment = true
+		case c == ';':
+			inLineComment = true
+		case c == '(':
+			depth++
+		case c == ')' && depth > 0:
+			depth--
+		case c == '[' && depth == 0:
+			if inMoves {
+				// a game without a result
+				g.pending = []byte{c}
+				return strings.TrimSpace(string(text)), nil
+			}
+			inTag = true
+		}
+		text = append(text, c)
+	}
+	switch {
+	case inComment:
+		return "", fmt.Errorf("Unterminated comment in '%s'", strings.TrimSpace(string(text)))
+	case depth > 0:
+		return "", fmt.Errorf("Unterminated variation in '%s'", strings.TrimSpace(string(text)))
+	case inTag:
+		return "", fmt.Errorf("Unterminated tag in '%s'", strings.TrimSpace(string(text)))
+	case strings.TrimSpace(string(text)) == "":
+		return "", io.EOF
+	}
+	return strings.TrimSpace(string(text)), nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// A comment wrapped over lines, with a line starting with '[', used to be
+// split off as a separate game, on which the pgn package hangs.
+const wrappedCommentPGN = `[Event "Rated blitz game"]
+[White "alice"]
+[Black "bob"]
+[Result "1-0"]
+
+1. e4 { [%clk 0:03:00] A long comment that is wrapped over a line
+[starting with a bracket] } 1... e5 { [%clk 0:02:58] } 2. Qh5 Nc6 3. Bc4 Nf6
+4. Qxf7# 1-0
+
+[Event "Rated blitz game"]
+[White "bob"]
+[Black "alice"]
+[Result "0-1"]
+
+1. d4 d5 { (not a variation } 2. c4 e6 0-1
+`
+
+func parsePGNWithTimeout(t *testing.T, text string) ([]*Game, error) {
+	type result struct {
+		games []*Game
+		err   error
+	}
+	done := make(chan result, 1)
+	go func() {
+		games, err := ParsePGN(text)
+		done <- result{games, err}
+	}()
+	select {
+	case r := <-done:
+		return r.games, r.err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out parsing the PGN")
+		return nil, nil
+	}
+}
+
+func TestParsePGNWrappedComment(t *testing.T) {
+	games, err := parsePGNWithTimeout(t, wrappedCommentPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 {
+		t.Fatalf("Expected 2 games, got %d", len(games))
+	}
+	if games[0].Tags["White"] != "alice" || games[1].Tags["White"] != "bob" {
+		t.Errorf("Unexpected players %s and %s", games[0].Tags["White"], games[1].Tags["White"])
+	}
+	if len(games[0].Moves) != 7 || len(games[1].Moves) != 4 {
+		t.Errorf("Expected 7 and 4 moves, got %d and %d", len(games[0].Moves), len(games[1].Moves))
+	}
+	comments := games[0].Comments
+	if len(comments) < 2 || !strings.Contains(comments[0], "[starting with a bracket]") || !strings.Contains(comments[1], "0:02:58") {
+		t.Errorf("Unexpected comments %q", comments)
+	}
+	if !strings.HasPrefix(games[1].Text, `[Event "Rated blitz game"]`) {
+		t.Errorf("Unexpected text of the second game %q", games[1].Text)
+	}
+}
+
+func TestParsePGNUnterminatedComment(t *testing.T) {
+	_, err := parsePGNWithTimeout(t, "[Event \"?\"]\n\n1. e4 { never closed\n[%clk 0:03:00] e5 *\n")
+	if err == nil || !strings.Contains(err.Error(), "Unterminated comment") {
+		t.Errorf("Expected an unterminated comment error, got %v", err)
+	}
+}
+
+func TestParsePGNTexts(t *testing.T) {
+	games, err := parsePGNWithTimeout(t, `[White "alice"]
+
+1. e4 { first } e5 1-0
+[White "bob"]
+
+1. d4 { second } d5 2. c4
+[White "carol"]
+
+1. c4 { third } *`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 3 {
+		t.Fatalf("Expected 3 games, got %d", len(games))
+	}
+	for i, test := range []struct {
+		white, comment string
+		moves          int
+	}{
+		{"alice", "first", 2},
+		{"bob", "second", 3},
+		{"carol", "third", 1},
+	} {
+		game := games[i]
+		if game.Tags["White"] != test.white || len(game.Moves) != test.moves {
+			t.Errorf("Expected %s with %d moves, got %s with %d", test.white, test.moves, game.Tags["White"], len(game.Moves))
+		}
+		if !strings.HasPrefix(game.Text, `[White "`+test.white+`"]`) || len(game.Comments) == 0 || game.Comments[0] != test.comment {
+			t.Errorf("Expected the text and comments of %s, got %q and %q", test.white, game.Text, game.Comments)
+		}
+	}
+}
+
+func TestParsePGNAnnotations(t *testing.T) {
+	games, err := parsePGNWithTimeout(t, `[Opening "Sicilian (Najdorf)"]
+
+1. e4 { [%eval 0.3] } { (a comment) } 1... c5 (1... e5 2. Nf3 (2. f4) Nc6) ; a line comment
+2. Nf3 *`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 1 || len(games[0].Moves) != 3 || games[0].Tags["Opening"] != "Sicilian (Najdorf)" {
+		t.Fatalf("Unexpected games %v", games)
+	}
+	if comments := games[0].Comments; len(comments) != 3 || comments[0] != "[%eval 0.3] (a comment)" {
+		t.Errorf("Unexpected comments %q", comments)
+	}
+	if variations := ParseMoveVariations(games[0].Text); len(variations) != 3 || strings.Join(variations[1], " ") != "e5 Nf3 Nc6" {
+		t.Errorf("Unexpected variations %q", variations)
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/binary"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// polyglotPieces are the FEN letters of the pieces in the order of the
+// Polyglot piece kinds.
+const polyglotPieces = "pPnNbBrRqQkK"
+
+// PolyglotKey returns the Zobrist hash of the position as used in Polyglot
+// books.
+func PolyglotKey(b *pgn.Board) uint64 {
+	fields := strings.Fields(b.String())
+	var key uint64
+	squares := [8][8]byte{}
+	for i, row := range strings.Split(fields[0], "/") {
+		rank := 7 - i
+		file := 0
+		for _, c := range row {
+			if c >= '1' && c <= '8' {
+				file += int(c - '0')
+				continue
+			}
+			if file < 8 {
+				squares[rank][file] = byte(c)
+				key ^= PolyglotRandom[64*strings.IndexRune(polyglotPieces, c)+8*rank+file]
+			}
+			file++
+		}
+	}
+	for i, right := range "KQkq" {
+		if strings.ContainsRune(fields[2], right) {
+			key ^= PolyglotRandom[768+i]
+		}
+	}
+	// the en passant file only counts if a pawn can actually capture
+	if ep := fields[3]; ep != "-" && len(ep) == 2 {
+		file := int(ep[0] - 'a')
+		pawn, rank := byte('P'), 4
+		if fields[1] == "b" {
+			pawn, rank = 'p', 3
+		}
+		if file > 0 && squares[rank][file-1] == pawn || file < 7 && squares[rank][file+1] == pawn {
+			key ^= PolyglotRandom[772+file]
+		}
+	}
+	if fields[1] == "w" {
+		key ^= PolyglotRandom[780]
+	}
+	return key
+}
+
+// PolyglotMove encodes a move in coordinate notation as a Polyglot move,
+// given the board before the move. Castling is encoded as the king
+// capturing its own rook.
+func PolyglotMove(b *pgn.Board, coord string) uint16 {
+	move, err := pgn.MoveFromCoord(coord)
+	if err != nil {
+		return 0
+	}
+	from, to := coord[0:2], coord[2:4]
+	piece := b.GetPiece(move.From)
+	if piece == pgn.WhiteKing || piece == pgn.BlackKing {
+		switch from + to {
+		case "e1g1", "e8g8":
+			to = "h" + to[1:]
+		case "e1c1", "e8c8":
+			to = "a" + to[1:]
+		}
+	}
+	encoded := uint16(to[0]-'a') | uint16(to[1]-'1')<<3 | uint16(from[0]-'a')<<6 | uint16(from[1]-'1')<<9
+	if len(coord) == 5 {
+		encoded |= uint16(strings.IndexByte(" nbrq", coord[4])) << 12
+	}
+	return encoded
+}
+
+// PolyglotEntry is a move in a Polyglot book.
+type PolyglotEntry struct {
+	Key    uint64
+	Move   uint16
+	Weight uint16
+	Learn  uint32
+}
+
+// PolyglotBook collects the weights of the moves per position.
+type PolyglotBook map[uint64]map[uint16]int
+
+// Add adds the weight to the move from the given position.
+func (p PolyglotBook) Add(b *pgn.Board, coord string, weight int) {
+	key := PolyglotKey(b)
+	if p[key] == nil {
+		p[key] = map[uint16]int{}
+	}
+	p[key][PolyglotMove(b, coord)] += weight
+}
+
+// PolyglotWeight returns the weight of a move played in the games: a win
+// counts 3, a draw 2 and a loss 1, for the side that played the move.
+func PolyglotWeight(s *Statistic, player bool) int {
+	won, lost := s.TotalWon, s.TotalLost
+	if !player {
+		won, lost = lost, won
+	}
+	return 3*won + 2*s.TotalDrawn + lost
+}
+
+// AddTree adds the moves in the player's white or black tree to the book.
+// With sides "ours" only the player's own moves are added, otherwise the
+// opponents' moves as well.
+func (p PolyglotBook) AddTree(tree *MoveTree, player string, white bool, sides string) {
+	tree.Walk(func(node *MoveTree) {
+		if node.Parent == nil {
+			return
+		}
+		line := node.Line()
+		byPlayer := (len(line)%2 == 1) == white
+		if sides == "ours" && !byPlayer {
+			return
+		}
+		p.Add(node.Parent.Board(), node.Move, PolyglotWeight(node.Statistic(player), byPlayer))
+	})
+}
+
+// AddBook adds every move in the opening classification with weight 1.
+func (p PolyglotBook) AddBook(tree *MoveTree) {
+	tree.Walk(func(node *MoveTree) {
+		if node.Parent != nil {
+			p.Add(node.Parent.Board(), node.Move, 1)
+		}
+	})
+}
+
+// Entries returns the moves sorted by key and, per key, by weight. The
+// weights are scaled down if they don't fit in 16 bits.
+func (p PolyglotBook) Entries() []PolyglotEntry {
+	max := 0
+	for _, moves := range p {
+		for _, weight := range moves {
+			if weight > max {
+				max = weight
+			}
+		}
+	}
+	entries := []PolyglotEntry{}
+	for key, moves := range p {
+		for move, weight := range moves {
+			if max > 0xffff {
+				weight = weight * 0xffff / max
+				if weight == 0 {
+					weight = 1
+				}
+			}
+			entries = append(entries, PolyglotEntry{Key: key, Move: move, Weight: uint16(weight)})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Key != entries[j].Key {
+			return entries[i].Key < entries[j].Key
+		}
+		if entries[i].Weight != entries[j].Weight {
+			return entries[i].Weight > entries[j].Weight
+		}
+		return entries[i].Move < entries[j].Move
+	})
+	return entries
+}
+
+// Write writes the book in the Polyglot .bin format.
+func (p PolyglotBook) Write(w io.Writer) error {
+	for _, entry := range p.Entries() {
+		if err := binary.Write(w, binary.BigEndian, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/freeeve/pgn"
+)
+
+// The keys from the Polyglot book format specification.
+func TestPolyglotKey(t *testing.T) {
+	b := pgn.NewBoard()
+	for _, test := range []struct {
+		move string
+		key  uint64
+	}{
+		{"", 0x463b96181691fc9c},
+		{"e2e4", 0x823c9b50fd114196},
+		{"d7d5", 0x0756b94461c50fb0},
+		{"e4e5", 0x662fafb965db29d4},
+		{"f7f5", 0x22a48b5a8e47ff78},
+		{"e1e2", 0x652a607ca3f242c1},
+		{"e8f7", 0x00fdd303c946bdd9},
+	} {
+		if test.move != "" {
+			move, err := pgn.MoveFromCoord(test.move)
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.MakeMove(move)
+		}
+		if key := PolyglotKey(b); key != test.key {
+			t.Errorf("Expected key %016x after %s, got %016x", test.key, test.move, key)
+		}
+	}
+}
+
+func TestPolyglotMove(t *testing.T) {
+	games, err := ParsePGN(`[FEN "k7/4P3/8/8/8/8/8/4K2R w K - 0 1"]
+[SetUp "1"]
+
+1. e8=Q+ Kb7 2. O-O *`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	game := games[0]
+	for _, test := range []struct {
+		ply   int
+		coord string
+		move  uint16
+	}{
+		{0, "e7e8q", 0x4d3c},
+		{2, "e1g1", 0x0107},
+	} {
+		b, _ := GameBoard(game.Game, test.ply)
+		coord := Coord(game.Moves[test.ply])
+		if coord != test.coord {
+			t.Errorf("Expected %s, got %s", test.coord, coord)
+		}
+		if move := PolyglotMove(b, coord); move != test.move {
+			t.Errorf("Expected %s to be written as %04x, got %04x", coord, test.move, move)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// PositionVisit is a game reaching a position.
+type PositionVisit struct {
+	Game *pgn.Game
+	// Ply is the number of plies played before the position was reached.
+	Ply int
+	// Next is the move played in the position, in coordinate notation, or
+	// the empty string if the game ended there.
+	Next string
+}
+
+// PositionIndex maps the positions reached in a collection of games, by
+// PositionKey, to the games that reached them. Positions compare equal
+// regardless of the move order that led to them.
+type PositionIndex map[string][]*PositionVisit
+
+// Add replays the game and adds every position it reached. A position that
+// is repeated in the game is only added the first time.
+func (p PositionIndex) Add(game *pgn.Game) {
+	b, ok := GameBoard(game, 0)
+	if !ok {
+		return
+	}
+	seen := map[string]bool{}
+	for ply := 0; ply <= len(game.Moves); ply++ {
+		key := PositionKey(b)
+		if !seen[key] {
+			seen[key] = true
+			visit := &PositionVisit{Game: game, Ply: ply}
+			if ply < len(game.Moves) {
+				visit.Next = Coord(game.Moves[ply])
+			}
+			p[key] = append(p[key], visit)
+		}
+		if ply < len(game.Moves) {
+			b.MakeMove(game.Moves[ply])
+		}
+	}
+}
+
+// ParsePosition parses a position given as a FEN, of which the move
+// counters can be left out, or as a sequence of moves from the starting
+// position in SAN or coordinate notation, e.g. "1. e4 c5 2. Nf3".
+func ParsePosition(position string) (*pgn.Board, error) {
+	position = strings.TrimSpace(position)
+	if position == "" {
+		return nil, fmt.Errorf("Empty position: give a FEN or moves from the starting position")
+	}
+	if strings.Contains(position, "/") {
+		fields := strings.Fields(position)
+		if len(fields) == 4 {
+			fields = append(fields, "0", "1")
+		}
+		b, err := pgn.NewBoardFEN(strings.Join(fields, " "))
+		if err != nil || len(fields) != 6 {
+			return nil, fmt.Errorf("Invalid FEN '%s'", position)
+		}
+		return b, nil
+	}
+	moves, b, err := ParseLine(position)
+	if err == nil && len(moves) == 0 {
+		return nil, fmt.Errorf("Invalid position '%s': give a FEN or moves from the starting position", position)
+	}
+	return b, err
+}
+
+// PositionSearch holds the games that reached a position.
+type PositionSearch struct {
+	Board  *pgn.Board
+	Visits []*PositionVisit
+}
+
+// Search returns the games that reached the position, oldest first.
+func (p PositionIndex) Search(b *pgn.Board) *PositionSearch {
+	visits := append([]*PositionVisit{}, p[PositionKey(b)]...)
+	sort.SliceStable(visits, func(i, j int) bool {
+		a, _ := GameDate(visits[i].Game)
+		b, _ := GameDate(visits[j].Game)
+		return a.Before(b)
+	})
+	return &PositionSearch{Board: b, Visits: visits}
+}
+
+// MoveData returns per move played in the position how often it was played
+// and how it scored, from white's perspective. The most played moves come
+// first.
+func (s *PositionSearch) MoveData() [][]string {
+	type next struct {
+		move                    string
+		games, won, drawn, lost int
+	}
+	moves := map[string]*next{}
+	order := []*next{}
+	for _, visit := range s.Visits {
+		n, ok := moves[visit.Next]
+		if !ok {
+			n = &next{move: visit.Next}
+			moves[visit.Next] = n
+			order = append(order, n)
+		}
+		n.games++
+		switch visit.Game.Tags["Result"] {
+		case "1-0":
+			n.won++
+		case "0-1":
+			n.lost++
+		case "1/2-1/2":
+			n.drawn++
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return order[i].games > order[j].games
+	})
+	data := [][]string{}
+	for _, n := range order {
+		move := "Game ended"
+		if n.move != "" {
+			move = moveSAN(s.Board, n.move)
+		}
+		data = append(data, []string{
+			move,
+			percentage(n.games, len(s.Visits)),
+			percentage(n.won, n.games),
+			percentage(n.drawn, n.games),
+			percentage(n.lost, n.games),
+		})
+	}
+	return data
+}
+
+// GameData returns a row per game that reached the position.
+func (s *PositionSearch) GameData() [][]string {
+	data := [][]string{}
+	for _, visit := range s.Visits {
+		next := ""
+		if visit.Next != "" {
+			next = moveSAN(s.Board, visit.Next)
+		}
+		data = append(data, []string{
+			visit.Game.Tags["Date"],
+			visit.Game.Tags["White"],
+			visit.Game.Tags["Black"],
+			visit.Game.Tags["Result"],
+			fmt.Sprintf("%d", visit.Ply),
+			next,
+			GameLink(visit.Game),
+		})
+	}
+	return data
+}
+
+func (s *PositionSearch) String() string {
+	b := bytes.NewBuffer([]byte{})
+	fmt.Fprintf(b, "%d game(s) reached %s\n", len(s.Visits), s.Board)
+	RenderTable(b, "Moves played in the position",
+		[]string{"Move", "Games", "White won", "Drawn", "Black won"}, s.MoveData())
+	RenderTable(b, "Games that reached the position",
+		[]string{"Date", "White", "Black", "Result", "Ply", "Next move", "Link"}, s.GameData())
+	return string(b.Bytes())
+}
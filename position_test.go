@@ -0,0 +1,34 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParsePosition(t *testing.T) {
+	for _, test := range []struct {
+		position, fen, err string
+	}{
+		{"1. e4 c5 2. Nf3", "rnbqkbnr/pp1ppppp/8/2p5/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - 1 2", ""},
+		{"e2e4 c7c5", "rnbqkbnr/pp1ppppp/8/2p5/4P3/8/PPPP1PPP/RNBQKBNR w KQkq c6 0 2", ""},
+		{"rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq -", "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1", ""},
+		{"", "", "Empty position"},
+		{"  ", "", "Empty position"},
+		{"1.", "", "Invalid position '1.'"},
+		{"1. e4 e4", "", "Invalid move 'e4' after '1.e4'"},
+		{"rnbqkbnr/pppppppp w", "", "Invalid FEN"},
+	} {
+		b, err := ParsePosition(test.position)
+		if test.err != "" {
+			if err == nil || !strings.HasPrefix(err.Error(), test.err) {
+				t.Errorf("Expected error %q for %q, got %v", test.err, test.position, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Unexpected error for %q: %s", test.position, err)
+		} else if b.String() != test.fen {
+			t.Errorf("Expected %s for %q, got %s", test.fen, test.position, b)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Preparation intersects the player's repertoire with an opponent's: the
+// player's white tree with the opponent's black tree and vice versa.
+type Preparation struct {
+	Mine     *Report
+	Theirs   *Report
+	MinGames int
+}
+
+func NewPreparation(mine, theirs *Report, minGames int) *Preparation {
+	return &Preparation{
+		Mine:     mine,
+		Theirs:   theirs,
+		MinGames: minGames,
+	}
+}
+
+// Meetings returns the deepest positions that were reached in at least
+// MinGames games by both players, so where the repertoires meet. The
+// walk starts from the root of both trees and follows the moves that occur
+// in both.
+func (p *Preparation) Meetings(mine, theirs *MoveTree) [][]string {
+	data := [][]string{}
+	var walk func(mine, theirs *MoveTree)
+	walk = func(mine, theirs *MoveTree) {
+		deeper := false
+		for move, myReply := range mine.Replies {
+			theirReply, ok := theirs.Replies[move]
+			if !ok || len(myReply.Games) < p.MinGames || len(theirReply.Games) < p.MinGames {
+				continue
+			}
+			deeper = true
+			walk(myReply, theirReply)
+		}
+		if deeper || mine.Parent == nil {
+			return
+		}
+		myStats := mine.Statistic(p.Mine.Player)
+		theirStats := theirs.Statistic(p.Theirs.Player)
+		data = append(data, []string{
+			FormatLine(mine.Line()),
+			fmt.Sprintf("%d", myStats.TotalPlayed),
+			fmt.Sprintf("%.0f%%", myStats.Score()),
+			fmt.Sprintf("%d", theirStats.TotalPlayed),
+			fmt.Sprintf("%.0f%%", theirStats.Score()),
+			usualMove(mine),
+			usualMove(theirs),
+		})
+	}
+	walk(mine, theirs)
+	sort.Slice(data, func(i, j int) bool {
+		return data[i][0] < data[j][0]
+	})
+	return data
+}
+
+func usualMove(tree *MoveTree) string {
+	if len(tree.Replies) == 0 {
+		return ""
+	}
+	usual := tree.SortedReplies()[0]
+	return fmt.Sprintf("%s (%d)", usual.SAN(), len(usual.Games))
+}
+
+// Deviations returns the positions both players reached where the opponent,
+// on move, played moves that never occurred in the player's games, ordered
+// by how often they did.
+func (p *Preparation) Deviations(mine, theirs *MoveTree, opponentIsWhite bool) [][]string {
+	type deviation struct {
+		tree  *MoveTree
+		count int
+	}
+	deviations := []deviation{}
+	var walk func(mine, theirs *MoveTree)
+	walk = func(mine, theirs *MoveTree) {
+		whiteToMove := len(mine.Line())%2 == 0
+		for move, theirReply := range theirs.Replies {
+			myReply, ok := mine.Replies[move]
+			if ok {
+				walk(myReply, theirReply)
+			} else if whiteToMove == opponentIsWhite {
+				deviations = append(deviations, deviation{theirReply, len(theirReply.Games)})
+			}
+		}
+	}
+	walk(mine, theirs)
+	sort.SliceStable(deviations, func(i, j int) bool {
+		if deviations[i].count != deviations[j].count {
+			return deviations[i].count > deviations[j].count
+		}
+		return FormatLine(deviations[i].tree.Line()) < FormatLine(deviations[j].tree.Line())
+	})
+	data := [][]string{}
+	for _, d := range deviations {
+		if d.count < p.MinGames {
+			break
+		}
+		theirStats := d.tree.Statistic(p.Theirs.Player)
+		data = append(data, []string{
+			FormatLine(d.tree.Parent.Line()),
+			d.tree.SAN(),
+			fmt.Sprintf("%d", d.count),
+			fmt.Sprintf("%.0f%%", theirStats.Score()),
+		})
+	}
+	return data
+}
+
+func (p *Preparation) String() string {
+	b := bytes.NewBuffer([]byte{})
+	me, them := p.Mine.Player, p.Theirs.Player
+	meetingsHeader := []string{"Line", "Games " + me, "Score " + me, "Games " + them, "Score " + them, "Next " + me, "Next " + them}
+	deviationsHeader := []string{"Line", them + " played", "Games", "Score " + them}
+
+	RenderTable(b, me+" as white against "+them+" as black", meetingsHeader, p.Meetings(p.Mine.White, p.Theirs.Black))
+	RenderTable(b, "Where "+them+" leaves "+me+"'s white repertoire", deviationsHeader, p.Deviations(p.Mine.White, p.Theirs.Black, false))
+	RenderTable(b, me+" as black against "+them+" as white", meetingsHeader, p.Meetings(p.Mine.Black, p.Theirs.White))
+	RenderTable(b, "Where "+them+" leaves "+me+"'s black repertoire", deviationsHeader, p.Deviations(p.Mine.Black, p.Theirs.White, true))
+	return string(b.Bytes())
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// Puzzle is a position from one of the player's lost games, just before a
+// mistake, with the line the engine preferred as the solution.
+type Puzzle struct {
+	Game    *pgn.Game
+	Player  string
+	Opening string
+	Mistake *Mistake
+	// Solution is the engine's line from the position, or the game's
+	// variation after the mistake, in coordinate notation, starting with the
+	// move that should have been played.
+	Solution []string
+}
+
+// Link returns the URL of the game the puzzle comes from: chess.com's Link
+// tag, or the Site tag for lichess.
+func (p *Puzzle) Link() string {
+	return GameLink(p.Game)
+}
+
+// ID identifies the puzzle by the game's URL or players and the ply of the
+// mistake.
+func (p *Puzzle) ID() string {
+	id := p.Link()
+	if id == "" {
+		id = p.Game.Tags["White"] + "-" + p.Game.Tags["Black"] + "-" + p.Game.Tags["Date"]
+	} else {
+		id = id[strings.LastIndex(id, "/")+1:]
+	}
+	return fmt.Sprintf("%s-%d", id, p.Mistake.Ply)
+}
+
+// Puzzles returns a puzzle for every mistake that lost at least minSwing
+// centipawns in the player's lost games, within the first moves. Only
+// openings containing one of the filters are included, if any are given.
+// The solutions come from the report's engine or, without an engine, from
+// the variations in the game that replace the mistakes, as in lichess'
+// analysis. Mistakes without a solution are left out.
+func (r *Report) Puzzles(moves, minSwing int, filters []string) ([]*Puzzle, error) {
+	openings := []string{}
+	records := map[string][]*GameRecord{}
+	for _, record := range r.Games {
+		if !matchesOpening(record.Opening, filters) {
+			continue
+		}
+		if _, ok := records[record.Opening]; !ok {
+			openings = append(openings, record.Opening)
+		}
+		records[record.Opening] = append(records[record.Opening], record)
+	}
+	sort.Strings(openings)
+	puzzles := []*Puzzle{}
+	for _, opening := range openings {
+		for _, record := range records[opening] {
+			game, white := record.Game.Game, record.White
+			if Score(white, game.Tags["Result"]) != 0 {
+				continue
+			}
+			evaluations, err := GameEvaluations(record.Game, r.Engine, 2*moves)
+			if err != nil {
+				return nil, err
+			}
+			for _, mistake := range FindMistakes(game, white, evaluations) {
+				if mistake.Loss < minSwing {
+					continue
+				}
+				solution, err := r.solution(record.Game, mistake)
+				if err != nil {
+					return nil, err
+				}
+				if len(solution) == 0 {
+					continue
+				}
+				puzzles = append(puzzles, &Puzzle{game, r.Player, opening, mistake, solution})
+			}
+		}
+	}
+	return puzzles, nil
+}
+
+func matchesOpening(opening string, filters []string) bool {
+	if len(filters) == 0 {
+		return true
+	}
+	for _, filter := range filters {
+		if strings.Contains(strings.ToLower(opening), strings.ToLower(strings.TrimSpace(filter))) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *Report) solution(game *Game, mistake *Mistake) ([]string, error) {
+	before := mistake.Before
+	if len(before.PV) == 0 && before.BestMove == "" && r.Engine != nil {
+		var err error
+		before, err = r.Engine.Evaluate(mistake.FEN)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(before.PV) > 0 {
+		return before.PV, nil
+	}
+	if before.BestMove != "" {
+		return []string{before.BestMove}, nil
+	}
+	return variationSolution(game, mistake), nil
+}
+
+// variationSolution returns the moves of the game's variation that replaces
+// the mistake, in coordinate notation, or nil if there is none.
+func variationSolution(game *Game, mistake *Mistake) []string {
+	variations := ParseMoveVariations(game.Text)
+	if mistake.Ply >= len(variations) {
+		return nil
+	}
+	b, err := pgn.NewBoardFEN(mistake.FEN)
+	if err != nil {
+		return nil
+	}
+	fields := strings.Fields(mistake.FEN)
+	white := len(fields) < 2 || fields[1] == "w"
+	solution := []string{}
+	for _, san := range variations[mistake.Ply] {
+		coord := ParseMove(b, strings.TrimRight(san, "+#!?"), white)
+		if coord == "" {
+			break
+		}
+		move, _ := pgn.MoveFromCoord(coord)
+		b.MakeMove(move)
+		solution = append(solution, coord)
+		white = !white
+	}
+	if len(solution) == 0 || solution[0] == mistake.Move {
+		return nil
+	}
+	return solution
+}
+
+// PuzzlesPGN writes every puzzle as a game starting from the position
+// before the mistake, with the solution as its moves.
+func PuzzlesPGN(puzzles []*Puzzle) string {
+	b := bytes.NewBuffer([]byte{})
+	for _, p := range puzzles {
+		board, err := pgn.NewBoardFEN(p.Mistake.FEN)
+		if err != nil {
+			continue
+		}
+		tags := [][2]string{
+			{"Event", "Puzzle: " + p.Opening},
+			{"Site", p.Link()},
+			{"Date", p.Game.Tags["Date"]},
+			{"White", p.Game.Tags["White"]},
+			{"Black", p.Game.Tags["Black"]},
+			{"Result", "*"},
+			{"SetUp", "1"},
+			{"FEN", p.Mistake.FEN},
+			{"Opening", p.Opening},
+			{"Annotator", fmt.Sprintf("Played %s, losing %.2f", moveSAN(board, p.Mistake.Move), float64(p.Mistake.Loss)/100)},
+		}
+		for _, tag := range tags {
+			fmt.Fprintf(b, "[%s \"%s\"]\n", tag[0], strings.Replace(tag[1], "\"", "'", -1))
+		}
+		fmt.Fprintf(b, "\n%s *\n\n", FormatMoves(board, p.Solution))
+	}
+	return string(b.Bytes())
+}
+
+var nonAlphanumeric = regexp.MustCompile(`[^A-Za-z0-9]+`)
+
+// PuzzlesCSV writes the puzzles in the format of the lichess puzzle
+// database, which most puzzle trainers can import. As in that format the
+// FEN is the position before the opponent's move that preceded the
+// mistake, and the moves start with that move. Mistakes on the first move
+// of a game can't be written this way and are left out.
+func PuzzlesCSV(puzzles []*Puzzle) string {
+	b := bytes.NewBuffer([]byte{})
+	w := csv.NewWriter(b)
+	w.Write([]string{"PuzzleId", "FEN", "Moves", "Rating", "RatingDeviation", "Popularity", "NbPlays", "Themes", "GameUrl", "OpeningTags"})
+	for _, p := range puzzles {
+		if p.Mistake.Ply == 0 {
+			continue
+		}
+		board, ok := GameBoard(p.Game, p.Mistake.Ply-1)
+		if !ok {
+			continue
+		}
+		moves := append([]string{Coord(p.Game.Moves[p.Mistake.Ply-1])}, p.Solution...)
+		rating := ""
+		if elo := PlayerElo(p.Game, p.Player); elo > 0 {
+			rating = fmt.Sprintf("%d", elo)
+		}
+		url := p.Link()
+		if url != "" {
+			url += fmt.Sprintf("#%d", p.Mistake.Ply)
+		}
+		w.Write([]string{
+			p.ID(),
+			board.String(),
+			strings.Join(moves, " "),
+			rating,
+			"", "", "",
+			"opening",
+			url,
+			strings.Trim(nonAlphanumeric.ReplaceAllString(p.Opening, "_"), "_"),
+		})
+	}
+	w.Flush()
+	return string(b.Bytes())
+}
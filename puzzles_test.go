@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// Lichess' analysis adds the better line after a mistake as a variation.
+const puzzlesPGN = `[Site "https://lichess.org/abcdefgh"]
+[White "alice"]
+[Black "bob"]
+[Result "0-1"]
+
+1. e4 { [%eval 0.3] } 1... e5 { [%eval 0.3] } 2. Qh5 { [%eval 0.0] } 2... Nc6 { [%eval 0.1] }
+3. Qxf7+?? { (0.10 → -5.00) Blunder. Bc4 was best. } { [%eval -5.0] } (3. Bc4 Nf6 4. Qf3) 3... Kxf7 { [%eval -5.0] } 0-1
+
+[Site "https://lichess.org/bcdefghi"]
+[White "alice"]
+[Black "bob"]
+[Result "0-1"]
+
+1. e4 { [%eval 0.3] } 1... e5 { [%eval 0.3] } 2. Qh5 { [%eval 0.0] } 2... Nc6 { [%eval 0.1] }
+3. Qxf7+ { [%eval -5.0] } 3... Kxf7 { [%eval -5.0] } 0-1
+`
+
+func TestPuzzlesWithoutEngine(t *testing.T) {
+	games, err := ParsePGN(puzzlesPGN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := NewReport("alice")
+	for _, game := range games {
+		report.Games = append(report.Games, &GameRecord{Game: game, White: true, Opening: "Danvers Opening"})
+	}
+	puzzles, err := report.Puzzles(15, 200, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the mistake in the second game has no solution
+	if len(puzzles) != 1 {
+		t.Fatalf("Expected 1 puzzle, got %d", len(puzzles))
+	}
+	puzzle := puzzles[0]
+	if puzzle.Mistake.Ply != 4 || strings.Join(puzzle.Solution, " ") != "f1c4 g8f6 h5f3" {
+		t.Errorf("Unexpected puzzle at ply %d with solution %v", puzzle.Mistake.Ply, puzzle.Solution)
+	}
+	if pgn := PuzzlesPGN(puzzles); !strings.Contains(pgn, "\n3.Bc4 Nf6 4.Qf3 *\n") {
+		t.Errorf("Unexpected PGN %s", pgn)
+	}
+	if csv := PuzzlesCSV(puzzles); !strings.Contains(csv, "abcdefgh-4,rnbqkbnr/pppp1ppp/8/4p2Q/4P3/8/PPPP1PPP/RNB1KBNR b KQkq - 1 2,b8c6 f1c4 g8f6 h5f3,") {
+		t.Errorf("Unexpected CSV %s", csv)
+	}
+}
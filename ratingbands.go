@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ParseRatingBands parses a comma separated list of rating differences
+// (e.g. -200,-50,50,200) into the boundaries of the rating bands.
+func ParseRatingBands(s string) ([]int, error) {
+	bands := []int{}
+	for _, field := range strings.Split(s, ",") {
+		boundary, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid rating band boundary '%s' in '%s'", field, s)
+		}
+		bands = append(bands, boundary)
+	}
+	sort.Ints(bands)
+	return bands, nil
+}
+
+// RatingBandLabels returns the names of the rating bands in order, e.g.
+// for -200,-50,50,200: <-200, -200..-51, -50..+49, +50..+199, ≥+200. The
+// lower boundary of a band is inclusive, so the labels of the inner bands
+// end one point below the next boundary.
+func RatingBandLabels(bands []int) []string {
+	labels := []string{fmt.Sprintf("<%+d", bands[0])}
+	for i := 1; i < len(bands); i++ {
+		labels = append(labels, fmt.Sprintf("%+d..%+d", bands[i-1], bands[i]-1))
+	}
+	return append(labels, fmt.Sprintf("≥%+d", bands[len(bands)-1]))
+}
+
+// RatingBand returns the index of the band the rating difference (opponent
+// - player) falls in. The lower boundary of a band is inclusive.
+func RatingBand(difference int, bands []int) int {
+	for i, boundary := range bands {
+		if difference < boundary {
+			return i
+		}
+	}
+	return len(bands)
+}
+
+// RatingBandReport splits the statistic of every opening by the rating
+// difference with the opponent. Games where either player is unrated are
+// left out.
+func (r *Report) RatingBandReport(bands []int) string {
+	labels := RatingBandLabels(bands)
+	openings := []string{}
+	for opening := range r.Openings {
+		openings = append(openings, opening)
+	}
+	sort.Strings(openings)
+
+	data := [][]string{}
+	total := make([]*Statistic, len(labels))
+	for i := range total {
+		total[i] = NewStatistic()
+	}
+	for _, opening := range openings {
+		stats := make([]*Statistic, len(labels))
+		for _, game := range r.Openings[opening] {
+			playerElo, opponentElo := PlayerElo(game, r.Player), OpponentElo(game, r.Player)
+			if playerElo == 0 || opponentElo == 0 {
+				continue
+			}
+			band := RatingBand(opponentElo-playerElo, bands)
+			if stats[band] == nil {
+				stats[band] = NewStatistic()
+			}
+			white := PlaysWhite(game, r.Player)
+			stats[band].Count(white, game.Tags["Result"])
+			total[band].Count(white, game.Tags["Result"])
+		}
+		for band, s := range stats {
+			if s != nil {
+				data = append(data, append([]string{opening, labels[band]}, s.Data()...))
+			}
+		}
+	}
+	for band, s := range total {
+		if s.TotalPlayed > 0 {
+			data = append(data, append([]string{"Total", labels[band]}, s.Data()...))
+		}
+	}
+	b := bytes.NewBuffer([]byte{})
+	RenderTable(b, "Openings by the opponent's rating difference",
+		append([]string{"Opening", "Rating +/-"}, r.Statistic.Headers()...), data)
+	return string(b.Bytes())
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// ReadRepertoire reads the prepared lines in a PGN file into a MoveTree.
+// Unlike AddNodeForPGN all variations are kept, so a single game with
+// variations can hold a complete repertoire. The games need to start from
+// the standard position.
+func ReadRepertoire(path string) (*MoveTree, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tree := NewMoveTree("", "Start position")
+	if err := SplitPGN(f, tree.AddVariations); err != nil {
+		return nil, fmt.Errorf("Invalid repertoire '%s': %s", path, err.Error())
+	}
+	return tree, nil
+}
+
+// AddVariations adds the moves of a game, including all its variations, to
+// the tree.
+func (m *MoveTree) AddVariations(text string) error {
+	node := m
+	stack := []*MoveTree{}
+	for _, token := range TokenizeMovetext(text) {
+		switch {
+		case strings.HasPrefix(token, "{"):
+		case token == "(":
+			// a variation replaces the last move
+			stack = append(stack, node)
+			if node.Parent != nil {
+				node = node.Parent
+			}
+		case token == ")":
+			if len(stack) == 0 {
+				return fmt.Errorf("Unexpected ) after %s", FormatLine(node.Line()))
+			}
+			node = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+		default:
+			white := len(node.Line())%2 == 0
+			move := ParseMove(node.Board(), strings.TrimRight(token, "+#!?"), white)
+			if move == "" {
+				return fmt.Errorf("Invalid move '%s' after '%s'", token, FormatLine(node.Line()))
+			}
+			node = node.GetOrInsertMove(move)
+		}
+	}
+	return nil
+}
+
+// PrepExit describes where a game left the player's repertoire.
+type PrepExit struct {
+	Game  *pgn.Game
+	White bool
+	// Node is the last position of the game that was in the repertoire.
+	Node *MoveTree
+	// Move is the first move that was not in the repertoire, in coordinate
+	// notation, or the empty string if the game stayed in prep.
+	Move string
+	// ByPlayer is set if the player played the move.
+	ByPlayer bool
+}
+
+// InPrep returns whether the game followed the repertoire until either the
+// prepared line or the game ended.
+func (p *PrepExit) InPrep() bool {
+	return p.Move == ""
+}
+
+func (p *PrepExit) Description() string {
+	switch {
+	case p.InPrep() && len(p.Node.Replies) == 0:
+		return "End of prep"
+	case p.InPrep():
+		return "Game ended in prep"
+	case p.ByPlayer:
+		return "Player deviated"
+	}
+	return "Opponent deviated"
+}
+
+// FollowRepertoire follows the game through the repertoire until it leaves
+// it.
+func FollowRepertoire(repertoire *MoveTree, game *pgn.Game, white bool) *PrepExit {
+	exit := &PrepExit{Game: game, White: white, Node: repertoire}
+	for i, move := range game.Moves {
+		if len(exit.Node.Replies) == 0 {
+			break
+		}
+		next, ok := exit.Node.Replies[Coord(move)]
+		if !ok {
+			exit.Move = Coord(move)
+			exit.ByPlayer = (i%2 == 0) == white
+			break
+		}
+		exit.Node = next
+	}
+	return exit
+}
+
+// RepertoireReport compares the player's games with their declared white
+// and black repertoires. Either can be nil.
+type RepertoireReport struct {
+	Player string
+	White  *MoveTree
+	Black  *MoveTree
+	Exits  []*PrepExit
+}
+
+func NewRepertoireReport(report *Report, white, black *MoveTree) *RepertoireReport {
+	r := &RepertoireReport{
+		Player: report.Player,
+		White:  white,
+		Black:  black,
+		Exits:  []*PrepExit{},
+	}
+	for _, games := range report.Openings {
+		for _, game := range games {
+			playsWhite := PlaysWhite(game, report.Player)
+			repertoire := r.Repertoire(playsWhite)
+			if repertoire == nil || IsCustomStart(game) {
+				continue
+			}
+			r.Exits = append(r.Exits, FollowRepertoire(repertoire, game, playsWhite))
+		}
+	}
+	sort.SliceStable(r.Exits, func(i, j int) bool {
+		a, _ := GameDate(r.Exits[i].Game)
+		b, _ := GameDate(r.Exits[j].Game)
+		return a.Before(b)
+	})
+	return r
+}
+
+func (r *RepertoireReport) Repertoire(white bool) *MoveTree {
+	if white {
+		return r.White
+	}
+	return r.Black
+}
+
+func colourName(white bool) string {
+	if white {
+		return "White"
+	}
+	return "Black"
+}
+
+// prepMoves returns the prepared moves in the position in SAN.
+func prepMoves(node *MoveTree) string {
+	moves := []string{}
+	for _, reply := range node.SortedReplies() {
+		moves = append(moves, reply.SAN())
+	}
+	return strings.Join(moves, ", ")
+}
+
+// GameData returns a row per game with where it left the repertoire.
+func (r *RepertoireReport) GameData() [][]string {
+	data := [][]string{}
+	for _, exit := range r.Exits {
+		played := ""
+		if !exit.InPrep() {
+			played = moveSAN(exit.Node.Board(), exit.Move)
+		}
+		data = append(data, []string{
+			exit.Game.Tags["Date"],
+			Opponent(exit.Game, r.Player),
+			colourName(exit.White),
+			exit.Game.Tags["Result"],
+			fmt.Sprintf("%d", len(exit.Node.Line())),
+			FormatLine(exit.Node.Line()),
+			exit.Description(),
+			played,
+			prepMoves(exit.Node),
+		})
+	}
+	return data
+}
+
+// LineData returns per colour and position where games left the
+// repertoire how often that happened and how, with the player's score.
+func (r *RepertoireReport) LineData() [][]string {
+	type line struct {
+		white     bool
+		node      *MoveTree
+		games     int
+		stayed    int
+		player    int
+		opponent  int
+		statistic *Statistic
+	}
+	lines := map[*MoveTree]*line{}
+	order := []*line{}
+	total := map[bool]*line{true: {white: true, statistic: NewStatistic()}, false: {statistic: NewStatistic()}}
+	for _, exit := range r.Exits {
+		l, ok := lines[exit.Node]
+		if !ok {
+			l = &line{white: exit.White, node: exit.Node, statistic: NewStatistic()}
+			lines[exit.Node] = l
+			order = append(order, l)
+		}
+		for _, l := range []*line{l, total[exit.White]} {
+			l.games++
+			switch {
+			case exit.InPrep():
+				l.stayed++
+			case exit.ByPlayer:
+				l.player++
+			default:
+				l.opponent++
+			}
+			l.statistic.Count(exit.White, exit.Game.Tags["Result"])
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		if order[i].white != order[j].white {
+			return order[i].white
+		}
+		return FormatLine(order[i].node.Line()) < FormatLine(order[j].node.Line())
+	})
+	data := [][]string{}
+	for _, l := range append(order, total[true], total[false]) {
+		if l.games == 0 {
+			continue
+		}
+		position := "Total"
+		if l.node != nil {
+			position = FormatLine(l.node.Line())
+			if position == "" {
+				position = "Start position"
+			}
+		}
+		data = append(data, []string{
+			colourName(l.white),
+			position,
+			fmt.Sprintf("%d", l.games),
+			percentage(l.stayed, l.games),
+			percentage(l.player, l.games),
+			percentage(l.opponent, l.games),
+			fmt.Sprintf("%.0f%%", l.statistic.Score()),
+		})
+	}
+	return data
+}
+
+// GapData returns the opponent moves that took games out of the
+// repertoire, with the player's score after them. The most played moves
+// come first, and of those the ones the player scored worst against.
+func (r *RepertoireReport) GapData() [][]string {
+	type gap struct {
+		exit      *PrepExit
+		statistic *Statistic
+	}
+	gaps := map[string]*gap{}
+	order := []*gap{}
+	for _, exit := range r.Exits {
+		if exit.InPrep() || exit.ByPlayer {
+			continue
+		}
+		key := colourName(exit.White) + " " + strings.Join(append(exit.Node.Line(), exit.Move), " ")
+		g, ok := gaps[key]
+		if !ok {
+			g = &gap{exit: exit, statistic: NewStatistic()}
+			gaps[key] = g
+			order = append(order, g)
+		}
+		g.statistic.Count(exit.White, exit.Game.Tags["Result"])
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		a, b := order[i].statistic, order[j].statistic
+		if a.TotalPlayed != b.TotalPlayed {
+			return a.TotalPlayed > b.TotalPlayed
+		}
+		return a.Score() < b.Score()
+	})
+	data := [][]string{}
+	for _, g := range order {
+		position := FormatLine(g.exit.Node.Line())
+		if position == "" {
+			position = "Start position"
+		}
+		data = append(data, []string{
+			colourName(g.exit.White),
+			position,
+			moveSAN(g.exit.Node.Board(), g.exit.Move),
+			fmt.Sprintf("%d", g.statistic.TotalPlayed),
+			fmt.Sprintf("%.0f%%", g.statistic.Score()),
+			prepMoves(g.exit.Node),
+		})
+	}
+	return data
+}
+
+func (r *RepertoireReport) String() string {
+	b := bytes.NewBuffer([]byte{})
+	RenderTable(b, r.Player+"'s games compared with the repertoire",
+		[]string{"Date", "Opponent", "Colour", "Result", "Prep plies", "Last prepared position", "Out of prep", "Played", "Prepared"}, r.GameData())
+	RenderTable(b, "Where the games left the repertoire",
+		[]string{"Colour", "Last prepared position", "Games", "Stayed in prep", "Player deviated", "Opponent deviated", "Score"}, r.LineData())
+	RenderTable(b, "Opponent moves without a prepared answer",
+		[]string{"Colour", "Last prepared position", "Opponent played", "Games", "Score", "Prepared"}, r.GapData())
+	return string(b.Bytes())
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const whiteRepertoire = `[Event "White repertoire"]
+
+1. e4 e5 (1... c5 2. Nf3 d6 (2... Nc6 3. d4) 3. d4) 2. Nf3 Nc6 3. Bc4 *`
+
+const blackRepertoire = `[Event "Black repertoire"]
+
+1. e4 c5 2. Nf3 d6 *
+
+[Event "Black repertoire"]
+
+1. e4 c5 2. c3 Nf6 *`
+
+func readTestRepertoire(t *testing.T, text string) *MoveTree {
+	tree := NewMoveTree("", "Start position")
+	if err := SplitPGN(strings.NewReader(text), tree.AddVariations); err != nil {
+		t.Fatal(err)
+	}
+	return tree
+}
+
+func TestAddVariations(t *testing.T) {
+	tree := readTestRepertoire(t, whiteRepertoire)
+	for _, test := range []struct {
+		line     string
+		prepared bool
+	}{
+		{"e2e4 e7e5 g1f3 b8c6 f1c4", true},
+		{"e2e4 c7c5 g1f3 d7d6 d2d4", true},
+		{"e2e4 c7c5 g1f3 b8c6 d2d4", true},
+		{"e2e4 e7e5 d2d4", false},
+		{"e2e4 c7c5 g1f3 d7d6 f1c4", false},
+	} {
+		if prepared := tree.Follow(strings.Fields(test.line)) != nil; prepared != test.prepared {
+			t.Errorf("Expected %s to be prepared: %v", FormatLine(strings.Fields(test.line)), test.prepared)
+		}
+	}
+	for _, test := range []struct {
+		text, err string
+	}{
+		{"1. e4 e5 2. Ke3 *", "Invalid move 'Ke3' after '1.e4 e5'"},
+		{"1. e4 e5) 2. Nf3 *", "Unexpected ) after 1.e4 e5"},
+	} {
+		if err := NewMoveTree("", "").AddVariations(test.text); err == nil || err.Error() != test.err {
+			t.Errorf("Expected error %q for %s, got %v", test.err, test.text, err)
+		}
+	}
+}
+
+func TestFollowRepertoire(t *testing.T) {
+	repertoires := map[bool]*MoveTree{
+		true:  readTestRepertoire(t, whiteRepertoire),
+		false: readTestRepertoire(t, blackRepertoire),
+	}
+	for _, test := range []struct {
+		white       bool
+		moves       string
+		prepPlies   int
+		move        string
+		description string
+	}{
+		{true, "1. e4 e5 2. Nf3 Nc6 3. Bc4 Bc5 4. c3", 5, "", "End of prep"},
+		{true, "1. e4 e5 2. Nf3", 3, "", "Game ended in prep"},
+		{true, "1. e4 e5 2. Bc4 Nf6", 2, "f1c4", "Player deviated"},
+		{true, "1. d4 d5", 0, "d2d4", "Player deviated"},
+		{true, "1. e4 c5 2. Nf3 e6 3. d4", 3, "e7e6", "Opponent deviated"},
+		{true, "1. e4 c5 2. Nf3 Nc6 3. d4 cxd4", 5, "", "End of prep"},
+		{false, "1. d4 d5", 0, "d2d4", "Opponent deviated"},
+		{false, "1. e4 e5", 1, "e7e5", "Player deviated"},
+		{false, "1. e4 c5 2. c3 Nf6 3. e5", 4, "", "End of prep"},
+		{false, "1. e4 c5 2. Nc3 Nc6", 2, "b1c3", "Opponent deviated"},
+		{false, "1. e4 c5 2. Nf3 Nc6", 3, "b8c6", "Player deviated"},
+	} {
+		games, err := ParsePGN(test.moves + " *")
+		if err != nil {
+			t.Fatal(err)
+		}
+		exit := FollowRepertoire(repertoires[test.white], games[0].Game, test.white)
+		if len(exit.Node.Line()) != test.prepPlies || exit.Move != test.move || exit.Description() != test.description {
+			t.Errorf("Expected %s to leave prep after %d plies with %q: %s, got %d plies with %q: %s", test.moves,
+				test.prepPlies, test.move, test.description, len(exit.Node.Line()), exit.Move, exit.Description())
+		}
+	}
+}
+
+func TestGapData(t *testing.T) {
+	report := NewReport("alice")
+	for _, game := range []struct {
+		white, black, moves, result string
+	}{
+		{"alice", "bob", "1. e4 c5 2. Nf3 e6", "1-0"},
+		{"alice", "bob", "1. e4 c5 2. Nf3 e6", "0-1"},
+		{"alice", "bob", "1. e4 c5 2. Nf3 e6", "0-1"},
+		{"alice", "bob", "1. e4 e6", "1-0"},
+		{"alice", "bob", "1. e4 e6", "1/2-1/2"},
+		{"alice", "bob", "1. e4 d5", "0-1"},
+		{"alice", "bob", "1. e4 d5", "0-1"},
+		// the player's deviations and the games in prep are no gaps
+		{"alice", "bob", "1. e4 e5 2. Bc4", "0-1"},
+		{"alice", "bob", "1. e4 e5 2. Nf3 Nc6 3. Bc4", "1-0"},
+		{"bob", "alice", "1. d4 d5", "0-1"},
+	} {
+		games, err := ParsePGN(fmt.Sprintf("[White \"%s\"]\n[Black \"%s\"]\n[Result \"%s\"]\n\n%s %s\n",
+			game.white, game.black, game.result, game.moves, game.result))
+		if err != nil {
+			t.Fatal(err)
+		}
+		report.Openings["Opening"] = append(report.Openings["Opening"], games[0].Game)
+	}
+	r := NewRepertoireReport(report, readTestRepertoire(t, whiteRepertoire), readTestRepertoire(t, blackRepertoire))
+	// the most played first, and the worst score first if as many games
+	expected := [][]string{
+		{"White", "1.e4 c5 2.Nf3", "e6", "3", "33%", "Nc6, d6"},
+		{"White", "1.e4", "d5", "2", "0%", "c5, e5"},
+		{"White", "1.e4", "e6", "2", "75%", "c5, e5"},
+		{"Black", "Start position", "d4", "1", "100%", "e4"},
+	}
+	data := r.GapData()
+	if len(data) != len(expected) {
+		t.Fatalf("Expected %d gaps, got %q", len(expected), data)
+	}
+	for i, row := range data {
+		if strings.Join(row, " | ") != strings.Join(expected[i], " | ") {
+			t.Errorf("Expected gap %d to be %q, got %q", i+1, expected[i], row)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// ScoutingReport summarises a player's repertoire from the white and black
+// move trees, e.g. to prepare for a match against them.
+type ScoutingReport struct {
+	Player string
+	White  *MoveTree
+	Black  *MoveTree
+
+	// MinGames is the number of games a line needs to be included in the
+	// weakest lines, the usual moves and the repertoire changes.
+	MinGames int
+	// Period is the length of the period (see Period) that is considered
+	// recent when looking for repertoire changes.
+	Period string
+}
+
+func NewScoutingReport(report *Report, minGames int, period string) *ScoutingReport {
+	return &ScoutingReport{
+		Player:   report.Player,
+		White:    report.White,
+		Black:    report.Black,
+		MinGames: minGames,
+		Period:   period,
+	}
+}
+
+// playerToMove returns whether it's the player's move at the node. The
+// player moves at even depths in the white tree and odd depths in the
+// black tree.
+func (s *ScoutingReport) playerToMove(root, tree *MoveTree) bool {
+	whiteToMove := len(tree.Line())%2 == 0
+	return whiteToMove == (root == s.White)
+}
+
+// FirstMoves lists the player's first moves as white.
+func (s *ScoutingReport) FirstMoves() [][]string {
+	data := [][]string{}
+	for _, tree := range s.White.SortedReplies() {
+		data = append(data, s.row(tree, FormatLine(tree.Line()), len(s.White.Games)))
+	}
+	return data
+}
+
+// Replies lists the player's replies as black to white's first moves.
+func (s *ScoutingReport) Replies() [][]string {
+	data := [][]string{}
+	for _, first := range s.Black.SortedReplies() {
+		for _, tree := range first.SortedReplies() {
+			data = append(data, s.row(tree, FormatLine(tree.Line()), len(first.Games)))
+		}
+	}
+	return data
+}
+
+// WeakestLines returns the positions after the player's own moves where
+// they scored worst, with at least MinGames games.
+func (s *ScoutingReport) WeakestLines(n int) [][]string {
+	type line struct {
+		tree  *MoveTree
+		score float64
+	}
+	lines := []line{}
+	for _, root := range []*MoveTree{s.White, s.Black} {
+		root.Walk(func(tree *MoveTree) {
+			if tree == root || len(tree.Games) < s.MinGames || !s.playerToMove(root, tree.Parent) {
+				return
+			}
+			lines = append(lines, line{tree, tree.Statistic(s.Player).Score()})
+		})
+	}
+	sort.SliceStable(lines, func(i, j int) bool {
+		if lines[i].score != lines[j].score {
+			return lines[i].score < lines[j].score
+		}
+		return len(lines[i].tree.Games) > len(lines[j].tree.Games)
+	})
+	data := [][]string{}
+	for i, l := range lines {
+		if i == n {
+			break
+		}
+		data = append(data, s.row(l.tree, FormatLine(l.tree.Line()), len(l.tree.Parent.Games)))
+	}
+	return data
+}
+
+// UsualMoves returns the player's most played move in every position where
+// it is their move, that was reached in at least MinGames games.
+func (s *ScoutingReport) UsualMoves() [][]string {
+	data := [][]string{}
+	for _, root := range []*MoveTree{s.White, s.Black} {
+		root.Walk(func(tree *MoveTree) {
+			if len(tree.Games) < s.MinGames || len(tree.Replies) == 0 || !s.playerToMove(root, tree) {
+				return
+			}
+			usual := tree.SortedReplies()[0]
+			data = append(data, s.row(usual, FormatLine(tree.Line()), len(tree.Games)))
+		})
+	}
+	return data
+}
+
+// Changes compares the player's usual moves in the most recent period with
+// the moves they played before, and returns the positions where they
+// switched to another move.
+func (s *ScoutingReport) Changes() [][]string {
+	recent := ""
+	for _, root := range []*MoveTree{s.White, s.Black} {
+		for _, game := range root.Games {
+			if p := Period(game, s.Period); p > recent {
+				recent = p
+			}
+		}
+	}
+	data := [][]string{}
+	for _, root := range []*MoveTree{s.White, s.Black} {
+		root.Walk(func(tree *MoveTree) {
+			if len(tree.Games) < s.MinGames || !s.playerToMove(root, tree) {
+				return
+			}
+			before, after := map[string]int{}, map[string]int{}
+			for _, reply := range tree.Replies {
+				for _, game := range reply.Games {
+					if Period(game, s.Period) == recent {
+						after[reply.Move] += 1
+					} else {
+						before[reply.Move] += 1
+					}
+				}
+			}
+			usualBefore, usualAfter := mostPlayed(before), mostPlayed(after)
+			if usualBefore == "" || usualAfter == "" || usualBefore == usualAfter {
+				return
+			}
+			data = append(data, []string{
+				FormatLine(tree.Line()),
+				tree.Replies[usualBefore].SAN(),
+				fmt.Sprintf("%d", before[usualBefore]),
+				tree.Replies[usualAfter].SAN(),
+				fmt.Sprintf("%d", after[usualAfter]),
+			})
+		})
+	}
+	return data
+}
+
+func mostPlayed(counts map[string]int) string {
+	result := ""
+	for move, count := range counts {
+		if result == "" || count > counts[result] || count == counts[result] && move < result {
+			result = move
+		}
+	}
+	return result
+}
+
+// row formats the line, the move of the node, how often it was played out of
+// total, and the player's score and performance rating.
+func (s *ScoutingReport) row(tree *MoveTree, line string, total int) []string {
+	stats := tree.Statistic(s.Player)
+	performance := ""
+	if stats.RatedPlayed > 0 {
+		performance = fmt.Sprintf("%d", stats.Performance())
+	}
+	return []string{
+		line,
+		tree.SAN(),
+		percentage(len(tree.Games), total),
+		fmt.Sprintf("%.0f%%", stats.Score()),
+		performance,
+	}
+}
+
+func (s *ScoutingReport) String() string {
+	b := bytes.NewBuffer([]byte{})
+	header := []string{"Line", "Move", "Played", "Score", "Performance"}
+	RenderTable(b, s.Player+"'s first moves as white", header, s.FirstMoves())
+	RenderTable(b, s.Player+"'s replies as black", header, s.Replies())
+	RenderTable(b, s.Player+"'s weakest lines", header, s.WeakestLines(10))
+	RenderTable(b, s.Player+"'s usual moves", header, s.UsualMoves())
+	RenderTable(b, s.Player+"'s repertoire changes in the last "+s.Period,
+		[]string{"Line", "Before", "Games", "Recently", "Games"}, s.Changes())
+	return string(b.Bytes())
+}
@@ -0,0 +1,29 @@
+#!/bin/sh
+# A fake UCI engine for trying out --engine without a real one installed.
+# Every position is evaluated as +0.25 for the side to move, with e2e4 as
+# the best move, e.g.:
+#
+#   chess-archive-collator --engine scripts/fake-uci-engine.sh --engine-cache "" games.pgn
+#
+# The score and move can be changed with FAKE_ENGINE_SCORE and
+# FAKE_ENGINE_MOVE.
+score=${FAKE_ENGINE_SCORE:-25}
+move=${FAKE_ENGINE_MOVE:-e2e4}
+while read -r command rest; do
+	case "$command" in
+	uci)
+		echo "id name Fake engine"
+		echo "uciok"
+		;;
+	isready)
+		echo "readyok"
+		;;
+	go)
+		echo "info depth 1 score cp $score pv $move"
+		echo "bestmove $move"
+		;;
+	quit)
+		exit 0
+		;;
+	esac
+done
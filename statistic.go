@@ -15,6 +15,11 @@ type Statistic struct {
 	Won    map[bool]int
 	Lost   map[bool]int
 	Drawn  map[bool]int
+
+	// The games against rated opponents, see Performance.
+	RatedPlayed     int
+	RatedScore      float64
+	OpponentRatings int
 }
 
 func NewStatistic() *Statistic {
@@ -41,21 +46,68 @@ func (s *Statistic) Count(white bool, result string) {
 	}
 }
 
+// CountOpponent keeps track of the opponent's rating. Games against unrated
+// opponents are ignored.
+func (s *Statistic) CountOpponent(white bool, result string, opponentElo int) {
+	if opponentElo <= 0 {
+		return
+	}
+	s.RatedPlayed += 1
+	s.RatedScore += Score(white, result)
+	s.OpponentRatings += opponentElo
+}
+
+// Score returns the player's points for a game: 1 for a win, 0.5 for a
+// draw and 0 for a loss.
+func Score(white bool, result string) float64 {
+	if result == "1-0" && white || result == "0-1" && !white {
+		return 1
+	} else if result == "0-1" && white || result == "1-0" && !white {
+		return 0
+	}
+	return 0.5
+}
+
+// Score returns the percentage of points scored.
+func (s *Statistic) Score() float64 {
+	if s.TotalPlayed == 0 {
+		return 0
+	}
+	return (float64(s.TotalWon) + float64(s.TotalDrawn)/2) / float64(s.TotalPlayed) * 100
+}
+
+// Performance returns the performance rating in the rated games: the
+// average rating of the opponents plus 400 points for every win, minus 400
+// for every loss, divided by the number of games.
+func (s *Statistic) Performance() int {
+	if s.RatedPlayed == 0 {
+		return 0
+	}
+	games := float64(s.RatedPlayed)
+	average := float64(s.OpponentRatings) / games
+	return int(average + 400*(2*s.RatedScore-games)/games)
+}
+
+// Summary formats the score, number of games and performance rating.
+func (s *Statistic) Summary() string {
+	if s == nil || s.TotalPlayed == 0 {
+		return ""
+	}
+	result := fmt.Sprintf("%.0f%% (%d)", s.Score(), s.TotalPlayed)
+	if s.RatedPlayed > 0 {
+		result += fmt.Sprintf(" %d", s.Performance())
+	}
+	return result
+}
+
 func (s *Statistic) Header() string {
 	return "Games\tWhite\tBlack\tWon\tLost\tDrawn\tWon(W)\tWon(B)\tLost(W)\tLost(B)\tDraw(W)\tDraw(B)"
 }
 
 func (s *Statistic) Headers() []string {
-	return []string{"Games", "White", "Black", "Won", "Lost", "Drawn", "Won(W)", "Won(B)", "Lost(W)", "Lost(B)", "Draw(W)", "Draw(B)"}
 	return strings.Split(s.Header(), "\t")
 }
 func (s Statistic) Data() []string {
-	percentage := func(c, d int) string {
-		if d == 0 || c == 0 {
-			return ""
-		}
-		return fmt.Sprintf("%3d (%0.f%%)", c, float64(c)/float64(d)*100)
-	}
 	return []string{
 		fmt.Sprintf("%d", s.TotalPlayed),
 		percentage(s.Played[true], s.TotalPlayed),
@@ -72,3 +124,10 @@ func (s Statistic) Data() []string {
 	}
 
 }
+
+func percentage(c, d int) string {
+	if d == 0 || c == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%3d (%0.f%%)", c, float64(c)/float64(d)*100)
+}
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"crypto/sha1"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/freeeve/pgn"
+	_ "modernc.org/sqlite"
+)
+
+// storeVersion is the version of the storeSchema, kept in the store's
+// PRAGMA user_version.
+const storeVersion = 1
+
+// storeSchema creates the tables of the game store. The files table
+// remembers the files that were imported, so that unchanged files don't
+// need to be read again. The classifications table keeps the classification
+// of the games per classifier, by the hash of its files, see
+// GameStore.ClassifiedGames.
+const storeSchema = `
+CREATE TABLE IF NOT EXISTS files (
+	path     TEXT PRIMARY KEY,
+	size     INTEGER NOT NULL,
+	modified INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS games (
+	id           TEXT PRIMARY KEY,
+	source       TEXT NOT NULL,
+	pgn          TEXT NOT NULL,
+	white        TEXT NOT NULL,
+	black        TEXT NOT NULL,
+	result       TEXT NOT NULL,
+	date         TEXT NOT NULL,
+	time_control TEXT NOT NULL,
+	termination  TEXT NOT NULL,
+	white_elo    INTEGER NOT NULL,
+	black_elo    INTEGER NOT NULL,
+	plies        INTEGER NOT NULL,
+	imported_at  TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS classifications (
+	game_id      TEXT NOT NULL REFERENCES games (id),
+	classifier   TEXT NOT NULL,
+	opening      TEXT NOT NULL,
+	eco          TEXT NOT NULL,
+	book_plies   INTEGER NOT NULL,
+	deviation    TEXT NOT NULL,
+	line         TEXT NOT NULL,
+	PRIMARY KEY (game_id, classifier)
+);
+`
+
+// GameStore keeps parsed games in a SQLite database, together with their
+// main tags and their classification, keyed by game id. Importing a file
+// only processes the games that are not in the store yet, and reports can
+// be generated from the stored games.
+type GameStore struct {
+	Path string
+	db   *sql.DB
+}
+
+// OpenGameStore opens the store in the given file, creating it if it
+// doesn't exist yet.
+func OpenGameStore(path string) (*GameStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := migrateStore(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("Invalid game store '%s': %s", path, err.Error())
+	}
+	return &GameStore{Path: path, db: db}, nil
+}
+
+// storeGameColumns are the columns of the games table that every version of
+// the store had.
+const storeGameColumns = `id, source, pgn, white, black, result, date, time_control, termination,
+	white_elo, black_elo, plies, imported_at`
+
+// migrateStore creates the tables of a new store, or brings the tables of
+// an older store up to the storeVersion. Stores without a version kept
+// their games with the classification of the time they were imported, in
+// columns that are now left out, so the classifications are made again.
+func migrateStore(db *sql.DB) error {
+	var version int
+	if err := db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version > storeVersion {
+		return fmt.Errorf("Made by a newer version (%d)", version)
+	} else if version == storeVersion {
+		return nil
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	err = migrateStoreTables(tx)
+	if err == nil {
+		_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", storeVersion))
+	}
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func migrateStoreTables(tx *sql.Tx) error {
+	var tables int
+	err := tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'games'").Scan(&tables)
+	if err != nil {
+		return err
+	}
+	if tables > 0 {
+		if _, err := tx.Exec("ALTER TABLE games RENAME TO unversioned_games"); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(storeSchema); err != nil {
+		return err
+	}
+	if tables == 0 {
+		return nil
+	}
+	_, err = tx.Exec("INSERT INTO games (" + storeGameColumns + ") SELECT " + storeGameColumns +
+		" FROM unversioned_games ORDER BY rowid")
+	if err == nil {
+		_, err = tx.Exec("DROP TABLE unversioned_games")
+	}
+	return err
+}
+
+func (s *GameStore) Close() error {
+	return s.db.Close()
+}
+
+// GameID identifies a game by its URL, or else by a hash of its PGN.
+func GameID(game *pgn.Game, text string) string {
+	if link := GameLink(game); link != "" {
+		return link
+	}
+	return fmt.Sprintf("sha1:%x", sha1.Sum([]byte(text)))
+}
+
+// unchanged returns whether the file was imported before and hasn't changed
+// since.
+func (s *GameStore) unchanged(path string, info os.FileInfo) (bool, error) {
+	var size, modified int64
+	err := s.db.QueryRow("SELECT size, modified FROM files WHERE path = ?", path).Scan(&size, &modified)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return size == info.Size() && modified == info.ModTime().UnixNano(), nil
+}
+
+// Import adds the games in the given files that are not in the store yet.
+// Files that didn't change since they were last imported are skipped. It
+// returns the number of games that were added and the number that were
+// already stored.
+func (s *GameStore) Import(paths []string) (int, int, error) {
+	added, stored := 0, 0
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return added, stored, err
+		}
+		if unchanged, err := s.unchanged(path, info); err != nil {
+			return added, stored, err
+		} else if unchanged {
+			fmt.Fprintln(os.Stderr, "Skipping unchanged", path)
+			continue
+		}
+		fmt.Fprintln(os.Stderr, "Importing", path)
+		tx, err := s.db.Begin()
+		if err != nil {
+			return added, stored, err
+		}
+		a, st, err := importGames(tx, path)
+		added, stored = added+a, stored+st
+		if err == nil {
+			_, err = tx.Exec("INSERT OR REPLACE INTO files (path, size, modified) VALUES (?, ?, ?)",
+				path, info.Size(), info.ModTime().UnixNano())
+		}
+		if err != nil {
+			tx.Rollback()
+			return added, stored, err
+		}
+		if err := tx.Commit(); err != nil {
+			return added, stored, err
+		}
+	}
+	return added, stored, nil
+}
+
+func importGames(tx *sql.Tx, path string) (int, int, error) {
+	added, stored := 0, 0
+	now := time.Now().UTC().Format(time.RFC3339)
+	var importErr error
+	err := ReadPGNFile(path, func(game *Game) {
+		if importErr != nil {
+			return
+		}
+		var exists bool
+		exists, importErr = importGame(tx, path, game, now)
+		if exists {
+			stored++
+		} else if importErr == nil {
+			added++
+		}
+	})
+	if err == nil {
+		err = importErr
+	}
+	return added, stored, err
+}
+
+// importGame adds the game if it's not in the store yet, and returns
+// whether it was.
+func importGame(tx *sql.Tx, path string, game *Game, now string) (bool, error) {
+	id := GameID(game.Game, game.Text)
+	var exists int
+	err := tx.QueryRow("SELECT COUNT(*) FROM games WHERE id = ?", id).Scan(&exists)
+	if err != nil {
+		return false, err
+	}
+	if exists > 0 {
+		return true, nil
+	}
+	_, err = tx.Exec(`INSERT INTO games (`+storeGameColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, path, game.Text, game.Tags["White"], game.Tags["Black"], game.Tags["Result"], game.Tags["Date"],
+		game.Tags["TimeControl"], game.Tags["Termination"], elo(game.Tags["WhiteElo"]), elo(game.Tags["BlackElo"]),
+		len(game.Moves), now)
+	return false, err
+}
+
+// storedNode is a position on the book line of a stored classification.
+type storedNode struct {
+	Move       string `json:"move"`
+	Annotation string `json:"annotation"`
+	ECO        string `json:"eco"`
+	Book       bool   `json:"book"`
+}
+
+// storedLine returns the book line of the classification, from the root to
+// its Node.
+func storedLine(classification *Classification) []storedNode {
+	line := []storedNode{}
+	for node := classification.Node; node != nil; node = node.Parent {
+		line = append([]storedNode{{node.Move, node.Annotation, node.ECO, node.Book}}, line...)
+	}
+	return line
+}
+
+// ClassifiedGames returns the stored games as a GameSource, in the order
+// they were imported, with their classification by the classifier with the
+// given hash, see ReadClassifier. The games that weren't classified by it
+// before are classified and stored first. The classifications are made on
+// a line of their own, which is only added to the classifier's tree when
+// the game is counted. Games with a FEN tag are classified again every
+// time, as the tree of an EPDClassifier depends on the games counted
+// before them.
+func (s *GameStore) ClassifiedGames(classifier Classifier, hash string) GameSource {
+	return func(count func(game *Game)) error {
+		if err := s.classify(classifier, hash); err != nil {
+			return err
+		}
+		rows, err := s.db.Query(`SELECT games.pgn, classifications.opening, classifications.eco,
+			classifications.book_plies, classifications.deviation, classifications.line
+			FROM games LEFT JOIN classifications
+			ON classifications.game_id = games.id AND classifications.classifier = ?
+			ORDER BY games.rowid`, hash)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var text string
+			var opening, eco, deviation, line sql.NullString
+			var bookPlies sql.NullInt64
+			if err := rows.Scan(&text, &opening, &eco, &bookPlies, &deviation, &line); err != nil {
+				return err
+			}
+			games, err := ParsePGN(text)
+			if err != nil {
+				return fmt.Errorf("Invalid game in the store: %s", err.Error())
+			}
+			for _, game := range games {
+				if line.Valid {
+					classification := &Classification{
+						Opening:   opening.String,
+						ECO:       eco.String,
+						BookPlies: int(bookPlies.Int64),
+						Deviation: deviation.String,
+						tree:      classifier.Tree(),
+					}
+					if err := classification.setLine(line.String); err != nil {
+						return fmt.Errorf("Invalid classification in the store: %s", err.Error())
+					}
+					game.Classification = classification
+				}
+				count(game)
+			}
+		}
+		return rows.Err()
+	}
+}
+
+// setLine points the classification at the stored book line, which is
+// built as a tree of its own.
+func (c *Classification) setLine(text string) error {
+	line := []storedNode{}
+	if err := json.Unmarshal([]byte(text), &line); err != nil {
+		return err
+	}
+	if len(line) == 0 {
+		return fmt.Errorf("Invalid line '%s'", text)
+	}
+	for i, stored := range line {
+		node := NewMoveTree(stored.Move, stored.Annotation)
+		node.ECO = stored.ECO
+		node.Book = stored.Book
+		if i > 0 {
+			c.Node.Replies[node.Move] = node
+			node.Parent = c.Node
+		}
+		c.Node = node
+		if i == 0 {
+			c.Start = node
+		}
+	}
+	return nil
+}
+
+// classify stores the classification of the games that weren't classified
+// by the classifier with the given hash yet. The games are read in batches,
+// as SQLite can't write while the games are being read.
+func (s *GameStore) classify(classifier Classifier, hash string) error {
+	classified := 0
+	last := int64(0)
+	for {
+		type storedGame struct {
+			rowid int64
+			id    string
+			text  string
+		}
+		rows, err := s.db.Query(`SELECT rowid, id, pgn FROM games WHERE rowid > ? AND id NOT IN
+			(SELECT game_id FROM classifications WHERE classifier = ?) ORDER BY rowid LIMIT 1000`, last, hash)
+		if err != nil {
+			return err
+		}
+		batch := []storedGame{}
+		for rows.Next() {
+			var game storedGame
+			if err := rows.Scan(&game.rowid, &game.id, &game.text); err != nil {
+				rows.Close()
+				return err
+			}
+			batch = append(batch, game)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		last = batch[len(batch)-1].rowid
+		tx, err := s.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, game := range batch {
+			var stored bool
+			stored, err = classifyGame(tx, classifier, hash, game.id, game.text)
+			if err != nil {
+				break
+			}
+			if stored {
+				classified++
+			}
+		}
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	if classified > 0 {
+		fmt.Fprintf(os.Stderr, "Classified %d stored game(s)\n", classified)
+	}
+	return nil
+}
+
+// classifyGame stores the classification of the game, and returns whether
+// it did: games with a FEN tag are left out.
+func classifyGame(tx *sql.Tx, classifier Classifier, hash, id, text string) (bool, error) {
+	games, err := ParsePGN(text)
+	if err != nil {
+		return false, fmt.Errorf("Invalid game in the store: %s", err.Error())
+	}
+	if len(games) != 1 {
+		return false, fmt.Errorf("Invalid game in the store: %s", id)
+	}
+	if IsCustomStart(games[0].Game) {
+		return false, nil
+	}
+	classification := classifier.Classify(games[0].Game)
+	line, err := json.Marshal(storedLine(classification))
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`INSERT INTO classifications (game_id, classifier, opening, eco, book_plies, deviation, line)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		id, hash, classification.Opening, classification.ECO, classification.BookPlies, classification.Deviation,
+		string(line))
+	return err == nil, err
+}
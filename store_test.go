@@ -0,0 +1,171 @@
+package main
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/freeeve/pgn"
+)
+
+const storePGN = `[Site "https://lichess.org/a"]
+[White "alice"]
+[Black "bob"]
+[Result "1-0"]
+
+1. e4 e5 2. Nf3 Nc6 3. Bb5 a6 1-0
+
+[Site "https://lichess.org/b"]
+[White "bob"]
+[Black "alice"]
+[Result "0-1"]
+
+1. e4 e5 2. Bc4 0-1
+`
+
+// countingClassifier counts the games that are classified.
+type countingClassifier struct {
+	Classifier
+	classified int
+}
+
+func (c *countingClassifier) Classify(game *pgn.Game) *Classification {
+	c.classified++
+	return c.Classifier.Classify(game)
+}
+
+func storeTestFile(t *testing.T) string {
+	path := filepath.Join(t.TempDir(), "games.pgn")
+	if err := ioutil.WriteFile(path, []byte(storePGN), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func storedClassifications(t *testing.T, source GameSource) []string {
+	result := []string{}
+	err := source(func(game *Game) {
+		c := game.Classification
+		if c == nil {
+			t.Fatalf("Expected the game to be classified")
+		}
+		result = append(result, strings.Join([]string{c.Opening, c.ECO, FormatLine(c.Node.Line()), c.Deviation}, " | "))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+func TestGameStoreClassifiedGames(t *testing.T) {
+	store, err := OpenGameStore(filepath.Join(t.TempDir(), "games.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, _, err := store.Import([]string{storeTestFile(t)}); err != nil {
+		t.Fatal(err)
+	}
+	classifier := &countingClassifier{Classifier: filterTestClassifier(t)}
+	expected := []string{
+		"Ruy Lopez | C60 | 1.e4 e5 2.Nf3 Nc6 3.Bb5 | a7a6",
+		"King's Pawn Game | C20 | 1.e4 e5 | f1c4",
+	}
+	// the games are only classified again for another classifier
+	for i, test := range []struct {
+		hash       string
+		classified int
+	}{
+		{"a", 2},
+		{"a", 0},
+		{"b", 2},
+		{"a", 0},
+	} {
+		classifier.classified = 0
+		classifications := storedClassifications(t, store.ClassifiedGames(classifier, test.hash))
+		if strings.Join(classifications, "\n") != strings.Join(expected, "\n") {
+			t.Errorf("Expected %q in run %d, got %q", expected, i+1, classifications)
+		}
+		if classifier.classified != test.classified {
+			t.Errorf("Expected %d games to be classified in run %d, got %d", test.classified, i+1, classifier.classified)
+		}
+	}
+}
+
+func TestGameStoreCountsEPDLine(t *testing.T) {
+	store, err := OpenGameStore(filepath.Join(t.TempDir(), "games.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if _, _, err := store.Import([]string{storeTestFile(t)}); err != nil {
+		t.Fatal(err)
+	}
+	classifier := NewEPDClassifier()
+	err = classifier.AddEPD(`rnbqkbnr/pppp1ppp/8/4p3/4P3/5N2/PPPP1PPP/RNBQKB1R b KQkq - ECO "C40"; opening "King's Knight";`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.ClassifiedGames(classifier, "epd")(func(game *Game) {
+		game.Classification.CountGame(game.Game)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := classifier.Tree().Follow([]string{"e2e4", "e7e5", "g1f3"})
+	if node == nil || node.Annotation != "King's Knight" || len(node.Games) != 1 || len(classifier.Tree().Games) != 0 {
+		t.Errorf("Expected the counted game to add its line to the tree")
+	}
+}
+
+func TestOpenGameStoreMigrates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "games.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the layout before the store was versioned, with the classification
+	// of the time the games were imported
+	_, err = db.Exec(`CREATE TABLE files (path TEXT PRIMARY KEY, size INTEGER NOT NULL, modified INTEGER NOT NULL);
+CREATE TABLE games (id TEXT PRIMARY KEY, source TEXT NOT NULL, pgn TEXT NOT NULL, white TEXT NOT NULL,
+	black TEXT NOT NULL, result TEXT NOT NULL, date TEXT NOT NULL, time_control TEXT NOT NULL,
+	termination TEXT NOT NULL, white_elo INTEGER NOT NULL, black_elo INTEGER NOT NULL, plies INTEGER NOT NULL,
+	eco TEXT NOT NULL, opening TEXT NOT NULL, book_plies INTEGER NOT NULL, deviation TEXT NOT NULL,
+	imported_at TEXT NOT NULL);
+INSERT INTO games VALUES ('https://lichess.org/old', 'old.pgn', '[Site "https://lichess.org/old"]
+[White "alice"]
+[Black "bob"]
+[Result "1-0"]
+
+1. d4 d5 1-0', 'alice', 'bob', '1-0', '', '', '', 0, 0, 2, 'D00', 'Queen''s Pawn', 2, '', '2020-01-01T00:00:00Z');`)
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := OpenGameStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	added, stored, err := store.Import([]string{storeTestFile(t)})
+	if err != nil || added != 2 || stored != 0 {
+		t.Fatalf("Expected 2 games to be added, got %d, %d: %v", added, stored, err)
+	}
+	ids := []string{}
+	err = store.ClassifiedGames(filterTestClassifier(t), "a")(func(game *Game) {
+		ids = append(ids, GameLink(game.Game))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(ids, " ") != "https://lichess.org/old https://lichess.org/a https://lichess.org/b" {
+		t.Errorf("Expected the old game to be kept, got %q", ids)
+	}
+	var version int
+	if err := store.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil || version != storeVersion {
+		t.Errorf("Expected version %d, got %d: %v", storeVersion, version, err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/freeeve/pgn"
+)
+
+// TerminationMethods are the ways a game can end, in the order they're
+// reported.
+var TerminationMethods = []string{
+	"Checkmate",
+	"Resignation",
+	"Time",
+	"Abandonment",
+	"Agreement",
+	"Repetition",
+	"Stalemate",
+	"Insufficient material",
+	"50-move rule",
+	"Other",
+}
+
+// TerminationMethod returns how the game ended, based on chess.com's
+// Termination tag (e.g. "bartspaans won by resignation", "Game drawn by
+// repetition") or lichess' ("Normal", "Time forfeit", "Abandoned").
+func TerminationMethod(game *pgn.Game) string {
+	termination := strings.ToLower(game.Tags["Termination"])
+	switch {
+	case strings.Contains(termination, "checkmate"):
+		return "Checkmate"
+	case strings.Contains(termination, "resignation"):
+		return "Resignation"
+	// "Game drawn by timeout vs insufficient material" is a draw on time
+	case strings.Contains(termination, "on time"),
+		strings.Contains(termination, "timeout"),
+		strings.Contains(termination, "time forfeit"):
+		return "Time"
+	case strings.Contains(termination, "abandon"):
+		return "Abandonment"
+	case strings.Contains(termination, "agreement"):
+		return "Agreement"
+	case strings.Contains(termination, "repetition"):
+		return "Repetition"
+	case strings.Contains(termination, "stalemate"):
+		return "Stalemate"
+	case strings.Contains(termination, "insufficient material"):
+		return "Insufficient material"
+	case strings.Contains(termination, "50-move"):
+		return "50-move rule"
+	}
+	return "Other"
+}
+
+// Outcome returns the result of the game from the player's perspective.
+func Outcome(white bool, result string) string {
+	switch Score(white, result) {
+	case 1:
+		return "Won"
+	case 0:
+		return "Lost"
+	}
+	return "Drawn"
+}
+
+// Terminations counts the games per colour, outcome and termination method.
+type Terminations map[bool]map[string]map[string]int
+
+func (t Terminations) Count(white bool, game *pgn.Game) {
+	outcome := Outcome(white, game.Tags["Result"])
+	if t[white] == nil {
+		t[white] = map[string]map[string]int{}
+	}
+	if t[white][outcome] == nil {
+		t[white][outcome] = map[string]int{}
+	}
+	t[white][outcome][TerminationMethod(game)] += 1
+}
+
+// Data returns a row per colour and outcome, with the percentage of games
+// that ended by each termination method.
+func (t Terminations) Data(opening string) [][]string {
+	data := [][]string{}
+	for _, white := range []bool{true, false} {
+		colour := "White"
+		if !white {
+			colour = "Black"
+		}
+		for _, outcome := range []string{"Won", "Lost", "Drawn"} {
+			methods := t[white][outcome]
+			if len(methods) == 0 {
+				continue
+			}
+			total := 0
+			for _, count := range methods {
+				total += count
+			}
+			row := []string{opening, colour, outcome, fmt.Sprintf("%d", total)}
+			for _, method := range TerminationMethods {
+				row = append(row, percentage(methods[method], total))
+			}
+			data = append(data, row)
+		}
+	}
+	return data
+}
+
+// TerminationReport shows how the games ended, per opening and in total.
+func (r *Report) TerminationReport() string {
+	openings := []string{}
+	for opening := range r.Openings {
+		openings = append(openings, opening)
+	}
+	sort.Strings(openings)
+
+	data := [][]string{}
+	total := Terminations{}
+	for _, opening := range openings {
+		terminations := Terminations{}
+		for _, game := range r.Openings[opening] {
+			white := PlaysWhite(game, r.Player)
+			terminations.Count(white, game)
+			total.Count(white, game)
+		}
+		data = append(data, terminations.Data(opening)...)
+	}
+	data = append(data, total.Data("Total")...)
+	b := bytes.NewBuffer([]byte{})
+	RenderTable(b, "How the games ended",
+		append([]string{"Opening", "Colour", "Result", "Games"}, TerminationMethods...), data)
+	return string(b.Bytes())
+}
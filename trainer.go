@@ -0,0 +1,259 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/freeeve/pgn"
+)
+
+// Card is the spaced repetition schedule of a position in the repertoire,
+// following the SM-2 algorithm.
+type Card struct {
+	Line        string    `json:"line"`
+	Repetitions int       `json:"repetitions"`
+	Interval    int       `json:"interval"` // days
+	Ease        float64   `json:"ease"`
+	Due         time.Time `json:"due"`
+}
+
+func NewCard(line string) *Card {
+	return &Card{Line: line, Ease: 2.5}
+}
+
+// IsDue returns whether the position should be asked again.
+func (c *Card) IsDue(now time.Time) bool {
+	return !c.Due.After(now)
+}
+
+// Review schedules the card after an answer, graded from 0 (no idea) to 5
+// (perfect). Wrong answers (below 3) are asked again in the next session.
+func (c *Card) Review(grade int, now time.Time) {
+	if grade >= 3 {
+		switch c.Repetitions {
+		case 0:
+			c.Interval = 1
+		case 1:
+			c.Interval = 6
+		default:
+			c.Interval = int(math.Round(float64(c.Interval) * c.Ease))
+		}
+		c.Repetitions += 1
+	} else {
+		c.Repetitions = 0
+		c.Interval = 0
+	}
+	q := float64(5 - grade)
+	c.Ease = math.Max(1.3, c.Ease+0.1-q*(0.08+q*0.02))
+	c.Due = now.AddDate(0, 0, c.Interval)
+}
+
+// TrainingProgress holds the cards of all positions that were trained,
+// keyed by player, colour and position.
+type TrainingProgress struct {
+	Path  string
+	Cards map[string]*Card
+}
+
+// LoadTrainingProgress reads the progress from the given file, or starts
+// with no progress if it doesn't exist yet.
+func LoadTrainingProgress(path string) (*TrainingProgress, error) {
+	progress := &TrainingProgress{Path: path, Cards: map[string]*Card{}}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return progress, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &progress.Cards); err != nil {
+		return nil, fmt.Errorf("Invalid training progress '%s': %s", path, err.Error())
+	}
+	return progress, nil
+}
+
+func (p *TrainingProgress) Save() error {
+	content, err := json.MarshalIndent(p.Cards, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p.Path, content, 0644)
+}
+
+// Card returns the card of the player's position, creating it if it wasn't
+// trained before.
+func (p *TrainingProgress) Card(player string, white bool, node *MoveTree) *Card {
+	colour := "white"
+	if !white {
+		colour = "black"
+	}
+	key := player + " " + colour + " " + PositionKey(node.Board())
+	if _, ok := p.Cards[key]; !ok {
+		p.Cards[key] = NewCard(trainingLine(node))
+	}
+	return p.Cards[key]
+}
+
+// Trainer drills the player's repertoire: it plays the opponent's moves,
+// weighted by how often the player faced them, and asks for the player's
+// move in the positions that are due.
+type Trainer struct {
+	Player   string
+	Progress *TrainingProgress
+	MinGames int
+
+	In   *bufio.Scanner
+	Out  io.Writer
+	Rand *rand.Rand
+	Now  func() time.Time
+
+	Asked   int
+	Correct int
+}
+
+func NewTrainer(player string, progress *TrainingProgress, minGames int, in io.Reader, out io.Writer) *Trainer {
+	return &Trainer{
+		Player:   player,
+		Progress: progress,
+		MinGames: minGames,
+		In:       bufio.NewScanner(in),
+		Out:      out,
+		Rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+		Now:      time.Now,
+	}
+}
+
+// Train plays the given number of lines from the player's white or black
+// tree. It stops early when the input ends or "quit" is entered.
+func (t *Trainer) Train(tree *MoveTree, white bool, lines int) error {
+	for i := 0; i < lines; i++ {
+		fmt.Fprintf(t.Out, "Line %d of %d\n", i+1, lines)
+		quit, err := t.TrainLine(tree, white)
+		if err != nil || quit {
+			return err
+		}
+		fmt.Fprintln(t.Out)
+	}
+	return nil
+}
+
+// replies returns the replies that were played at least MinGames times.
+func (t *Trainer) replies(node *MoveTree) []*MoveTree {
+	replies := []*MoveTree{}
+	for _, reply := range node.SortedReplies() {
+		if len(reply.Games) >= t.MinGames {
+			replies = append(replies, reply)
+		}
+	}
+	return replies
+}
+
+// opponentMove picks one of the replies, weighted by the number of games.
+func (t *Trainer) opponentMove(replies []*MoveTree) *MoveTree {
+	total := 0
+	for _, reply := range replies {
+		total += len(reply.Games)
+	}
+	n := t.Rand.Intn(total)
+	for _, reply := range replies {
+		n -= len(reply.Games)
+		if n < 0 {
+			return reply
+		}
+	}
+	return replies[len(replies)-1]
+}
+
+// TrainLine follows a single line through the tree until the player's
+// games run out. The expected answer is the move the player played most
+// often in the position.
+func (t *Trainer) TrainLine(tree *MoveTree, white bool) (bool, error) {
+	node := tree
+	for {
+		replies := t.replies(node)
+		if len(replies) == 0 {
+			return false, nil
+		}
+		whiteToMove := len(node.Line())%2 == 0
+		if whiteToMove != white {
+			node = t.opponentMove(replies)
+			fmt.Fprintf(t.Out, "Opponent plays %s\n", node.SAN())
+			continue
+		}
+		expected := replies[0]
+		card := t.Progress.Card(t.Player, white, node)
+		if !card.IsDue(t.Now()) {
+			fmt.Fprintf(t.Out, "You play %s\n", expected.SAN())
+			node = expected
+			continue
+		}
+		fmt.Fprintf(t.Out, "%s\nYour move: ", trainingLine(node))
+		if !t.In.Scan() {
+			return true, t.In.Err()
+		}
+		answer := strings.TrimSpace(t.In.Text())
+		if answer == "quit" {
+			return true, nil
+		}
+		t.Asked++
+		if ParseMove(node.Board(), answer, white) == expected.Move {
+			t.Correct++
+			card.Review(4, t.Now())
+			fmt.Fprintf(t.Out, "Correct, next review in %d day(s)\n", card.Interval)
+		} else {
+			card.Review(1, t.Now())
+			fmt.Fprintf(t.Out, "Your repertoire move is %s\n", expected.SAN())
+		}
+		if err := t.Progress.Save(); err != nil {
+			return true, err
+		}
+		node = expected
+	}
+}
+
+func trainingLine(node *MoveTree) string {
+	if node.Parent == nil {
+		return "Start position"
+	}
+	return FormatLine(node.Line())
+}
+
+// ParseMove returns the move in coordinate notation, given in SAN (Nf3) or
+// coordinate notation (g1f3), or the empty string if it's not a legal move.
+func ParseMove(b *pgn.Board, move string, white bool) string {
+	color := pgn.Black
+	if white {
+		color = pgn.White
+	}
+	coord, err := pgn.MoveFromCoord(move)
+	if err == nil {
+		// a coordinate move is legal if its SAN finds the same piece
+		move = SAN(b, coord)
+	}
+	parsed, err := b.MoveFromAlgebraic(move, color)
+	if err != nil || !possibleMove(b, parsed, color) {
+		return ""
+	}
+	if coord != pgn.NilMove && (coord.From != parsed.From || coord.To != parsed.To) {
+		return ""
+	}
+	return Coord(parsed)
+}
+
+// Due returns the number of the player's positions that are due.
+func (p *TrainingProgress) Due(player string, now time.Time) int {
+	due := 0
+	for key, card := range p.Cards {
+		if strings.HasPrefix(key, player+" ") && card.IsDue(now) {
+			due++
+		}
+	}
+	return due
+}
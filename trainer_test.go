@@ -0,0 +1,84 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/freeeve/pgn"
+)
+
+func TestCardReview(t *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	for _, test := range []struct {
+		repetitions, interval int
+		ease                  float64
+		grade                 int
+		// the schedule after the review
+		expectedRepetitions, expectedInterval int
+		expectedEase                          float64
+	}{
+		// a new card
+		{0, 0, 2.5, 5, 1, 1, 2.6},
+		{0, 0, 2.5, 4, 1, 1, 2.5},
+		{0, 0, 2.5, 3, 1, 1, 2.36},
+		{0, 0, 2.5, 2, 0, 0, 2.18},
+		{0, 0, 2.5, 1, 0, 0, 1.96},
+		{0, 0, 2.5, 0, 0, 0, 1.7},
+		// the second and later correct answers
+		{1, 1, 2.5, 4, 2, 6, 2.5},
+		{2, 6, 2.5, 4, 3, 15, 2.5},
+		{3, 15, 2.6, 5, 4, 39, 2.7},
+		{3, 15, 2.0, 3, 4, 30, 1.86},
+		// a wrong answer starts over
+		{4, 39, 2.7, 2, 0, 0, 2.38},
+		// the ease doesn't drop below 1.3
+		{0, 0, 1.4, 0, 0, 0, 1.3},
+		{0, 0, 1.3, 1, 0, 0, 1.3},
+		{2, 6, 1.3, 3, 3, 8, 1.3},
+	} {
+		card := &Card{Repetitions: test.repetitions, Interval: test.interval, Ease: test.ease}
+		card.Review(test.grade, now)
+		if card.Repetitions != test.expectedRepetitions || card.Interval != test.expectedInterval || math.Abs(card.Ease-test.expectedEase) > 1e-9 {
+			t.Errorf("Expected %d repetition(s), %d day(s) and ease %.2f after grade %d for %+v, got %d, %d and %.2f",
+				test.expectedRepetitions, test.expectedInterval, test.expectedEase, test.grade, test,
+				card.Repetitions, card.Interval, card.Ease)
+		}
+		if due := now.AddDate(0, 0, test.expectedInterval); !card.Due.Equal(due) {
+			t.Errorf("Expected the card to be due at %s, got %s", due, card.Due)
+		}
+		// wrong answers are asked again right away
+		if card.IsDue(now) != (test.grade < 3) {
+			t.Errorf("Expected the card to be due after grade %d: %v", test.grade, test.grade < 3)
+		}
+	}
+}
+
+func TestParseMove(t *testing.T) {
+	b, err := pgn.NewBoardFEN("rnbqkbnr/ppp1pppp/8/3p4/4P3/8/PPPP1PPP/RNBQKBNR w KQkq d6 0 2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		move, coord string
+	}{
+		{"exd5", "e4d5"},
+		{"e4d5", "e4d5"},
+		{"e5", "e4e5"},
+		{"d4", "d2d4"},
+		{"d3", "d2d3"},
+		{"Nf3", "g1f3"},
+		{"g1f3", "g1f3"},
+		{"e6", ""},
+		{"e2e5", ""},
+		{"g1e2", "g1e2"},
+		{"g1g3", ""},
+		{"Qd1", ""},
+		{"Ke2", "e1e2"},
+		{"d7d6", ""},
+	} {
+		if coord := ParseMove(b, test.move, true); coord != test.coord {
+			t.Errorf("Expected %s to parse as %q, got %q", test.move, test.coord, coord)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"sort"
+
+	"github.com/freeeve/pgn"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Period returns the week (2019-W40), month (2019-10) or quarter (2019-Q4)
+// the game was played in, or the empty string if the game has no date.
+func Period(game *pgn.Game, period string) string {
+	date, ok := GameDate(game)
+	if !ok {
+		return ""
+	}
+	switch period {
+	case "week":
+		year, week := date.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case "quarter":
+		return fmt.Sprintf("%d-Q%d", date.Year(), (int(date.Month())-1)/3+1)
+	}
+	return date.Format("2006-01")
+}
+
+// Trend contains the statistics of every opening per period.
+type Trend struct {
+	Periods  []string
+	Openings map[string]map[string]*Statistic
+}
+
+func NewTrend(report *Report, period string) *Trend {
+	trend := &Trend{
+		Periods:  []string{},
+		Openings: map[string]map[string]*Statistic{},
+	}
+	periods := map[string]bool{}
+	for opening, games := range report.Openings {
+		trend.Openings[opening] = map[string]*Statistic{}
+		for _, game := range games {
+			p := Period(game, period)
+			if p == "" {
+				continue
+			}
+			if _, ok := trend.Openings[opening][p]; !ok {
+				trend.Openings[opening][p] = NewStatistic()
+			}
+			white := PlaysWhite(game, report.Player)
+			trend.Openings[opening][p].Count(white, game.Tags["Result"])
+			trend.Openings[opening][p].CountOpponent(white, game.Tags["Result"], OpponentElo(game, report.Player))
+			periods[p] = true
+		}
+	}
+	for p := range periods {
+		trend.Periods = append(trend.Periods, p)
+	}
+	sort.Strings(trend.Periods)
+	return trend
+}
+
+// MinTrendGames is the number of games an opening needs in both periods for
+// a change to be significant, as the standard error is not reliable for
+// fewer games.
+const MinTrendGames = 5
+
+// Change returns the difference in score between two periods, and whether
+// the opening improved or declined significantly. The difference is
+// significant if it is larger than 1.96 times its standard error, i.e. at
+// the 95% confidence level, and both periods have at least MinTrendGames
+// games.
+func (t *Trend) Change(opening, from, to string) (float64, string) {
+	before, after := t.Openings[opening][from], t.Openings[opening][to]
+	if before == nil || after == nil {
+		return 0, ""
+	}
+	delta := after.Score() - before.Score()
+	if before.TotalPlayed < MinTrendGames || after.TotalPlayed < MinTrendGames {
+		return delta, ""
+	}
+	n1, n2 := float64(before.TotalPlayed), float64(after.TotalPlayed)
+	p := (before.Score()*n1 + after.Score()*n2) / (n1 + n2) / 100
+	stderr := math.Sqrt(p * (1 - p) * (1/n1 + 1/n2))
+	if stderr == 0 || math.Abs(delta/100) <= 1.96*stderr {
+		return delta, ""
+	}
+	if delta > 0 {
+		return delta, "improved"
+	}
+	return delta, "declined"
+}
+
+// String renders the score, number of games and performance rating of every
+// opening per period, and the change between the two compared periods. If
+// no periods are given the last two periods are compared.
+func (t *Trend) String(from, to string) string {
+	if from == "" && to == "" && len(t.Periods) >= 2 {
+		from, to = t.Periods[len(t.Periods)-2], t.Periods[len(t.Periods)-1]
+	}
+	openings := []string{}
+	for opening := range t.Openings {
+		openings = append(openings, opening)
+	}
+	sort.Strings(openings)
+
+	data := [][]string{}
+	for _, opening := range openings {
+		row := []string{opening}
+		for _, p := range t.Periods {
+			row = append(row, t.Openings[opening][p].Summary())
+		}
+		change := ""
+		if t.Openings[opening][from] != nil && t.Openings[opening][to] != nil {
+			delta, significance := t.Change(opening, from, to)
+			change = fmt.Sprintf("%+.0f%% %s", delta, significance)
+		}
+		data = append(data, append(row, change))
+	}
+	b := bytes.NewBuffer([]byte{})
+	table := tablewriter.NewWriter(b)
+	table.SetHeader(append(append([]string{"Opening"}, t.Periods...), from+" - "+to))
+	table.SetAutoFormatHeaders(false)
+	table.AppendBulk(data)
+	table.SetRowLine(true)
+	table.Render()
+	return string(b.Bytes())
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+// trendStatistic returns a statistic of the given number of games with
+// white, of which won were won and the rest lost.
+func trendStatistic(played, won int) *Statistic {
+	s := NewStatistic()
+	for i := 0; i < played; i++ {
+		result := "0-1"
+		if i < won {
+			result = "1-0"
+		}
+		s.Count(true, result)
+	}
+	return s
+}
+
+func TestTrendChange(t *testing.T) {
+	for _, test := range []struct {
+		before, beforeWon, after, afterWon int
+		delta                              float64
+		significance                       string
+	}{
+		// 20% to 80%: 60% is more than 1.96 * 22.4%
+		{10, 2, 10, 8, 60, "improved"},
+		{10, 8, 10, 2, -60, "declined"},
+		// 40% to 70%: 30% is less than 1.96 * 15.7% = 30.8%
+		{20, 8, 20, 14, 30, ""},
+		// 40% to 75%: 35% is more than 1.96 * 15.6% = 30.6%
+		{20, 8, 20, 15, 35, "improved"},
+		// too few games for any change to be significant
+		{1, 0, 1, 1, 100, ""},
+		{4, 0, 4, 4, 100, ""},
+		{4, 0, 10, 10, 100, ""},
+		{5, 0, 5, 5, 100, "improved"},
+		// the same score in both periods
+		{5, 5, 3, 3, 0, ""},
+		{5, 0, 3, 0, 0, ""},
+		// an opening that wasn't played in one of the periods
+		{0, 0, 5, 5, 0, ""},
+		{5, 5, 0, 0, 0, ""},
+	} {
+		trend := &Trend{Openings: map[string]map[string]*Statistic{"Sicilian": {}}}
+		if test.before > 0 {
+			trend.Openings["Sicilian"]["2019-10"] = trendStatistic(test.before, test.beforeWon)
+		}
+		if test.after > 0 {
+			trend.Openings["Sicilian"]["2019-11"] = trendStatistic(test.after, test.afterWon)
+		}
+		delta, significance := trend.Change("Sicilian", "2019-10", "2019-11")
+		if math.Abs(delta-test.delta) > 1e-9 || significance != test.significance {
+			t.Errorf("Expected %+.0f%% %q from %d/%d to %d/%d, got %+.0f%% %q", test.delta, test.significance,
+				test.beforeWon, test.before, test.afterWon, test.after, delta, significance)
+		}
+	}
+}
+
+func TestPeriod(t *testing.T) {
+	games, err := ParsePGN(`[UTCDate "2019.12.30"]
+[Date "2019.12.29"]
+
+1. e4 *
+
+[Date "2019.??.??"]
+
+1. d4 *`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		period   string
+		expected []string
+	}{
+		{"week", []string{"2020-W01", ""}},
+		{"month", []string{"2019-12", ""}},
+		{"quarter", []string{"2019-Q4", ""}},
+	} {
+		for i, game := range games {
+			if p := Period(game.Game, test.period); p != test.expected[i] {
+				t.Errorf("Expected %s %q, got %q", test.period, test.expected[i], p)
+			}
+		}
+	}
+}